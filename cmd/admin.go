@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/mail"
+	"os"
+	"slices"
+	"strings"
+
+	authpkg "github.com/AgentTarik/finance-api/internal/auth"
+	"github.com/AgentTarik/finance-api/internal/config"
+	kafkapkg "github.com/AgentTarik/finance-api/internal/kafka"
+	"github.com/AgentTarik/finance-api/internal/storage"
+	txworker "github.com/AgentTarik/finance-api/internal/transaction"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// runUser implements "user create".
+func runUser(ctx context.Context, log *zap.Logger, args []string) error {
+	if len(args) == 0 || args[0] != "create" {
+		return fmt.Errorf("%w: user needs a subcommand: create", errUsage)
+	}
+	fs := flag.NewFlagSet("user create", flag.ExitOnError)
+	cf := config.RegisterFlags(fs)
+	name := fs.String("name", "", "display name (required)")
+	email := fs.String("email", "", "email (required)")
+	password := fs.String("password", "", "password, at least 8 characters (default: read from stdin)")
+	role := fs.String("role", authpkg.RoleUser, "user | readonly | admin")
+	idFlag := fs.String("id", "", "user id (default: server-generated UUIDv7)")
+	_ = fs.Parse(args[1:])
+
+	var id uuid.UUID
+	if *idFlag != "" {
+		var err error
+		if id, err = uuid.Parse(*idFlag); err != nil {
+			return fmt.Errorf("%w: invalid -id: %v", errUsage, err)
+		}
+	}
+	*email = strings.ToLower(strings.TrimSpace(*email))
+	if _, err := mail.ParseAddress(*email); err != nil || len(strings.TrimSpace(*name)) < 2 {
+		return fmt.Errorf("%w: -name (2+ characters) and a valid -email are required", errUsage)
+	}
+	if !slices.Contains([]string{authpkg.RoleUser, authpkg.RoleReadOnly, authpkg.RoleAdmin}, *role) {
+		return fmt.Errorf("%w: unknown -role %q", errUsage, *role)
+	}
+	// read from stdin by default, so the password stays out of the shell history
+	if *password == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("read password from stdin: %w", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+	if len(*password) < 8 {
+		return fmt.Errorf("%w: the password needs at least 8 characters", errUsage)
+	}
+	cfg, err := cf.Load()
+	if err != nil {
+		return err
+	}
+
+	ps, err := openPostgres(log, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer ps.DB.Close()
+
+	pwHash, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u, err := ps.CreateUser(ctx, storage.NewUser{
+		ID: id, Name: strings.TrimSpace(*name), Email: *email, PasswordHash: string(pwHash), Role: *role,
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("user created",
+		zap.String("user_id", u.ID.String()),
+		zap.String("email", u.Email),
+		zap.String("role", *role))
+	fmt.Println(u.ID)
+	return nil
+}
+
+// runToken implements "token issue": it mints an access token through the
+// same JWTIssuer and keys as the API, so it is accepted like one from
+// /auth/login. Meant for testing; the token is printed on stdout.
+func runToken(ctx context.Context, log *zap.Logger, args []string) error {
+	if len(args) == 0 || args[0] != "issue" {
+		return fmt.Errorf("%w: token needs a subcommand: issue", errUsage)
+	}
+	fs := flag.NewFlagSet("token issue", flag.ExitOnError)
+	cf := config.RegisterFlags(fs)
+	user := fs.String("user", "", "user id or email (required)")
+	scopes := fs.String("scopes", "", "comma-separated scopes, a subset of the user's (default: all of them)")
+	_ = fs.Parse(args[1:])
+	if *user == "" {
+		return fmt.Errorf("%w: -user is required", errUsage)
+	}
+
+	cfg, err := cf.Load()
+	if err != nil {
+		return err
+	}
+	keys, err := authpkg.LoadKeySet(cfg.JWT)
+	if err != nil {
+		return fmt.Errorf("jwt keys init: %w", err)
+	}
+	issuer, err := authpkg.NewJWTIssuer(keys, cfg.JWT)
+	if err != nil {
+		return fmt.Errorf("jwt init: %w", err)
+	}
+
+	ps, err := openPostgres(log, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer ps.DB.Close()
+
+	var u *storage.UserAuth
+	if id, perr := uuid.Parse(*user); perr == nil {
+		u, err = ps.GetUserAuthByID(ctx, id)
+	} else {
+		u, err = ps.GetUserAuthByEmail(ctx, strings.ToLower(strings.TrimSpace(*user)))
+	}
+	if err != nil {
+		return err
+	}
+	if u.Deactivated {
+		return fmt.Errorf("user %s is deactivated", u.ID)
+	}
+
+	granted := authpkg.ScopesFor(u.Role, u.Scopes)
+	if *scopes != "" {
+		var narrowed []string
+		for _, s := range strings.Split(*scopes, ",") {
+			s = strings.TrimSpace(s)
+			if !slices.Contains(granted, s) {
+				return fmt.Errorf("%w: scope %q is not held by the user", errUsage, s)
+			}
+			narrowed = append(narrowed, s)
+		}
+		granted = narrowed
+	}
+
+	token, exp, err := issuer.Issue(u.ID.String(), u.Role, granted)
+	if err != nil {
+		return err
+	}
+	log.Info("access token issued",
+		zap.String("user_id", u.ID.String()),
+		zap.Strings("scopes", granted),
+		zap.Time("expires_at", exp))
+	fmt.Println(token)
+	return nil
+}
+
+// runReplayEvents puts open dead letters back into the outbox, as
+// POST /admin/dlq/:id/replay does one at a time. Schema rejects are
+// re-validated first and stay open if they still fail.
+func runReplayEvents(ctx context.Context, log *zap.Logger, args []string) error {
+	fs := flag.NewFlagSet("replay-events", flag.ExitOnError)
+	cf := config.RegisterFlags(fs)
+	idFlag := fs.String("id", "", "replay only this dead letter")
+	source := fs.String("source", "", "only this source: schema | publish (default: both)")
+	limit := fs.Int("limit", 100, "replay at most this many, newest first")
+	_ = fs.Parse(args)
+	if *source != "" && *source != storage.DeadLetterSchema && *source != storage.DeadLetterPublish {
+		return fmt.Errorf("%w: unknown -source %q", errUsage, *source)
+	}
+	if *limit < 1 {
+		return fmt.Errorf("%w: -limit must be positive", errUsage)
+	}
+	cfg, err := cf.Load()
+	if err != nil {
+		return err
+	}
+
+	ps, err := openPostgres(log, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer ps.DB.Close()
+	evVal, err := kafkapkg.NewValidator()
+	if err != nil {
+		return fmt.Errorf("schema validator init: %w", err)
+	}
+
+	var letters []storage.DeadLetter
+	if *idFlag != "" {
+		id, err := uuid.Parse(*idFlag)
+		if err != nil {
+			return fmt.Errorf("%w: invalid -id: %v", errUsage, err)
+		}
+		d, err := ps.GetDeadLetter(ctx, id)
+		if err != nil {
+			return err
+		}
+		letters = append(letters, d)
+	} else if letters, err = ps.ListDeadLetters(ctx, storage.DeadLetterOpen, *limit); err != nil {
+		return err
+	}
+
+	replayed, failed := 0, 0
+	for _, d := range letters {
+		if *source != "" && d.Source != *source {
+			continue
+		}
+		if d.Source == storage.DeadLetterSchema {
+			if err := evVal.Validate(d.Payload); err != nil {
+				log.Warn("payload still fails schema validation; left open",
+					zap.String("id", d.ID.String()), zap.Error(err))
+				failed++
+				continue
+			}
+		}
+		if err := ps.ReplayDeadLetter(ctx, d.ID); err != nil {
+			log.Error("dlq replay failed", zap.String("id", d.ID.String()), zap.Error(err))
+			failed++
+			continue
+		}
+		log.Info("dlq replayed", zap.String("id", d.ID.String()), zap.String("source", d.Source))
+		replayed++
+	}
+	log.Info("replay done", zap.Int("replayed", replayed), zap.Int("failed", failed))
+	if failed > 0 {
+		return fmt.Errorf("%d dead letters were not replayed", failed)
+	}
+	return nil
+}
+
+// runReprocess sends transactions back through the worker:
+//   - queued: rows waiting for a retry become claimable now, with a fresh
+//     attempt budget (rows leased to a live worker are left alone)
+//   - failed: rows move back to queued, as POST /admin/transactions/:id/retry
+//
+// Running workers pick them up on their next poll.
+func runReprocess(ctx context.Context, log *zap.Logger, args []string) error {
+	fs := flag.NewFlagSet("reprocess", flag.ExitOnError)
+	cf := config.RegisterFlags(fs)
+	status := fs.String("status", "", "queued | failed (required)")
+	reason := fs.String("reason", "manual reprocess", "reason recorded in the status history (failed only)")
+	_ = fs.Parse(args)
+
+	st, err := txworker.ParseStatus(*status)
+	if err != nil || (st != txworker.Queued && st != txworker.Failed) {
+		return fmt.Errorf("%w: -status must be queued or failed", errUsage)
+	}
+	cfg, err := cf.Load()
+	if err != nil {
+		return err
+	}
+
+	ps, err := openPostgres(log, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer ps.DB.Close()
+
+	if st == txworker.Queued {
+		n, err := ps.ResetQueued(ctx)
+		if err != nil {
+			return err
+		}
+		log.Info("queued transactions reset", zap.Int64("count", n))
+		return nil
+	}
+
+	requeued, skipped := 0, 0
+	f := storage.TxFilter{Status: string(txworker.Failed), Sort: storage.SortOldest, Limit: 200}
+	for {
+		page, err := ps.ListAllTx(ctx, f)
+		if err != nil {
+			return err
+		}
+		for _, t := range page.Items {
+			ch, err := txworker.Change(t.TransactionID, txworker.Failed, txworker.Queued, *reason)
+			if err == nil {
+				err = ps.ChangeStatus(ctx, ch)
+			}
+			if errors.Is(err, storage.ErrStatusConflict) {
+				skipped++ // changed meanwhile
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("requeue %s: %w", t.TransactionID, err)
+			}
+			requeued++
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		f.Cursor = page.NextCursor
+	}
+	log.Info("failed transactions requeued", zap.Int("count", requeued), zap.Int("skipped", skipped))
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/config"
+	"github.com/AgentTarik/finance-api/internal/migrate"
+	"go.uber.org/zap"
+)
+
+// runMigrate implements "migrate up | down [N] | status | force VERSION".
+// Configuration flags go before the action.
+func runMigrate(ctx context.Context, log *zap.Logger, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	cf := config.RegisterFlags(fs)
+	_ = fs.Parse(args)
+	if args = fs.Args(); len(args) == 0 {
+		return fmt.Errorf("%w: migrate needs up, down, status or force", errUsage)
+	}
+	cfg, err := cf.Load()
+	if err != nil {
+		return err
+	}
+	ps, err := openPostgres(log, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer ps.DB.Close()
+	m, err := migrate.New(ps.DB, log)
+	if err != nil {
+		return err
+	}
+
+	switch cmd, rest := args[0], args[1:]; {
+	case cmd == "up" && len(rest) == 0:
+		n, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		log.Info("migrations applied", zap.Int("count", n))
+	case cmd == "down" && len(rest) <= 1:
+		steps := 1
+		if len(rest) == 1 {
+			if steps, err = strconv.Atoi(rest[0]); err != nil || steps < 1 {
+				return fmt.Errorf("%w: down N must be a positive integer", errUsage)
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		log.Info("migrations rolled back", zap.Int("count", n))
+	case cmd == "status" && len(rest) == 0:
+		st, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range st {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	case cmd == "force" && len(rest) == 1:
+		v, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil || v < 0 {
+			return fmt.Errorf("%w: force VERSION must be a migration number", errUsage)
+		}
+		return m.Force(ctx, v)
+	default:
+		return fmt.Errorf("%w: migrate %s", errUsage, strings.Join(args, " "))
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/api"
+	authpkg "github.com/AgentTarik/finance-api/internal/auth"
+	"github.com/AgentTarik/finance-api/internal/config"
+	kafkapkg "github.com/AgentTarik/finance-api/internal/kafka"
+	"github.com/AgentTarik/finance-api/internal/mail"
+	"github.com/AgentTarik/finance-api/internal/migrate"
+	"github.com/AgentTarik/finance-api/internal/money"
+	"github.com/AgentTarik/finance-api/internal/outbox"
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/AgentTarik/finance-api/telemetry"
+
+	docs "github.com/AgentTarik/finance-api/docs"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// registerCustomValidations adds custom validators to the validator instance.
+func registerCustomValidations(v *validator.Validate) {
+	_ = v.RegisterValidation("uuid4", func(fl validator.FieldLevel) bool {
+		s := fl.Field().String()
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return false
+		}
+		// must be version 4
+		return id.Version() == 4
+	})
+	// positive decimal literal, e.g. "12.34" (no floats, no exponent)
+	_ = v.RegisterValidation("amount", func(fl validator.FieldLevel) bool {
+		s := fl.Field().String()
+		return money.ValidDecimal(s) && strings.Trim(s, "0.") != ""
+	})
+}
+
+// runServe runs the HTTP API and, unless -worker=false, the background
+// processing (see runWorker) in the same process.
+func runServe(ctx context.Context, log *zap.Logger, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	cf := config.RegisterFlags(fs)
+	migrateOnStart := fs.Bool("migrate", false,
+		"apply pending schema migrations before serving (same as -database.migrate_on_start)")
+	withWorker := fs.Bool("worker", true,
+		"also run the transaction worker and the outbox relay; disable when they run as separate worker processes")
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected argument %q", errUsage, fs.Arg(0))
+	}
+	cfg, err := cf.Load()
+	if err != nil {
+		return err
+	}
+
+	// Metrics
+	// registers collectors and sets up middleware/endpoint later
+	telemetry.InitMetrics()
+
+	// Database
+	ps, err := openPostgres(log, cfg.Database)
+	if err != nil {
+		return err
+	}
+	userRepo := ps
+	txRepo := ps
+
+	// Schema migrations (embedded in the binary)
+	if *migrateOnStart || cfg.Database.MigrateOnStart {
+		m, err := migrate.New(ps.DB, log)
+		if err != nil {
+			return fmt.Errorf("migrations init: %w", err)
+		}
+		n, err := m.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("migrations: %w", err)
+		}
+		log.Info("schema up to date", zap.Int("applied", n))
+	}
+
+	// Kafka Producer
+	prod := newProducer(log, cfg.Kafka)
+	if prod != nil {
+		defer prod.Close()
+	}
+
+	// HTTP payload validator (Gin binding + go-playground/validator)
+	v := validator.New()
+	registerCustomValidations(v)
+
+	// Event JSON schema validator
+	evVal, err := kafkapkg.NewValidator()
+	if err != nil {
+		return fmt.Errorf("schema validator init: %w", err)
+	}
+
+	// Async worker over the durable queue; it also provides admission
+	// control, so it is built even when it does not run here
+	worker := newWorker(log, txRepo, evVal, cfg.Worker)
+
+	// Outbox relay (outbox table -> Kafka)
+	var relay *outbox.Relay
+	if prod != nil {
+		relay = outbox.NewRelay(log, ps, prod, cfg.Relay)
+	} else {
+		log.Warn("outbox relay disabled; events stay in the outbox until Kafka is configured")
+	}
+
+	// DB health function for /health handler.
+	dbPing := ps.DB.PingContext
+
+	keys, err := authpkg.LoadKeySet(cfg.JWT)
+	if err != nil {
+		return fmt.Errorf("jwt keys init: %w", err)
+	}
+	issuer, err := authpkg.NewJWTIssuer(keys, cfg.JWT)
+	if err != nil {
+		return fmt.Errorf("jwt init: %w", err)
+	}
+	log.Info("jwt signing key loaded",
+		zap.String("kid", keys.Signing().ID),
+		zap.String("alg", keys.Signing().Method.Alg()))
+
+	actionTokens, err := authpkg.NewActionTokensFromConfig(cfg.Account, cfg.JWT)
+	if err != nil {
+		log.Warn("no action token secret; mailed links stop working on restart", zap.Error(err))
+		if actionTokens, err = authpkg.NewActionTokens(nil); err != nil {
+			return fmt.Errorf("action token init: %w", err)
+		}
+	}
+
+	// Mailer: SMTP relay, .eml files or the log
+	mailer, err := mail.New(cfg.Mail, log)
+	if err != nil {
+		return err
+	}
+
+	authH := &api.AuthHandlers{
+		Log:      log,
+		UsersDB:  ps,
+		V:        v,
+		Tokens:   issuer,
+		JWT:      cfg.JWT,
+		Keys:     keys,
+		Sessions: ps,
+		Guard:    authpkg.NewLoginGuard(ps, cfg.Login),
+		MFA:      ps,
+		APIKeys:  ps,
+
+		Accounts:     ps,
+		ActionTokens: actionTokens,
+		Mailer:       mailer,
+		Account:      cfg.Account,
+	}
+	// HTTP handlers
+	h := &api.Handlers{
+		Log:         log,
+		Users:       userRepo,
+		TxRepo:      txRepo,
+		Statuses:    ps,
+		Ledger:      ps,
+		Balances:    ps,
+		Reporting:   ps,
+		DeadLetters: ps,
+		IdemKeys:    ps,
+		Events:      evVal,
+		V:           v,
+		DBPing:      dbPing,
+		Kafka:       cfg.Kafka,
+		Admit:       worker.Admit,
+		Enqueue: func(t storage.Transaction) {
+			worker.Enqueue(t)
+		},
+		Auth: authH,
+	}
+
+	// Gin engine
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	// Prometheus HTTP metrics middleware
+	r.Use(telemetry.PrometheusMiddleware())
+
+	// Simple structured HTTP log middleware
+	r.Use(func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		log.Info("http",
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.FullPath()),
+			zap.Int("status", c.Writer.Status()),
+			zap.Duration("dur", time.Since(start)),
+		)
+	})
+
+	// App routes.
+	api.SetupRoutes(r, h)
+
+	docs.SwaggerInfo.Title = "Finance API"
+	docs.SwaggerInfo.Version = "1.0"
+	docs.SwaggerInfo.BasePath = "/v1"
+	docs.SwaggerInfo.Description = "Simple finance transactions API with JWT auth, Kafka events and metrics."
+	// Se você costuma acessar pela máquina local:
+	docs.SwaggerInfo.Schemes = []string{"http"}
+
+	// expor a UI do swagger
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	// Run worker and HTTP server
+	bgCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go purgeIdempotencyKeys(bgCtx, log, ps)
+	if *withWorker {
+		go worker.Run(bgCtx)
+		if relay != nil {
+			go relay.Run(bgCtx)
+		}
+	} else {
+		log.Info("worker disabled; transactions are processed by separate worker processes")
+	}
+
+	srv := &http.Server{Addr: cfg.HTTP.Addr, Handler: r}
+
+	// Start server asynchronously.
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("server error", zap.Error(err))
+		}
+	}()
+	log.Info("server started", zap.String("addr", cfg.HTTP.Addr))
+
+	// Graceful shutdown on SIGINT/SIGTERM.
+	<-ctx.Done()
+	cancel()
+
+	shutdownCtx, cancel2 := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel2()
+	_ = srv.Shutdown(shutdownCtx)
+	log.Info("server stopped")
+	return nil
+}
+
+// idempotencyPurgeInterval is how often expired Idempotency-Key rows are
+// deleted; lookups already ignore them, this only bounds the table.
+const idempotencyPurgeInterval = 10 * time.Minute
+
+// purgeIdempotencyKeys deletes expired idempotency keys until ctx is done.
+func purgeIdempotencyKeys(ctx context.Context, log *zap.Logger, repo storage.IdempotencyRepo) {
+	t := time.NewTicker(idempotencyPurgeInterval)
+	defer t.Stop()
+	for {
+		if n, err := repo.PurgeIdempotency(ctx); err != nil {
+			if ctx.Err() == nil {
+				log.Error("idempotency key purge failed", zap.Error(err))
+			}
+		} else if n > 0 {
+			log.Info("expired idempotency keys purged", zap.Int64("count", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/AgentTarik/finance-api/internal/config"
+	kafkapkg "github.com/AgentTarik/finance-api/internal/kafka"
+	"github.com/AgentTarik/finance-api/internal/outbox"
+	"github.com/AgentTarik/finance-api/telemetry"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// runWorker runs the background processing without the HTTP API: the
+// transaction worker over the durable queue and, when Kafka is configured,
+// the outbox relay. Any number of worker processes can share a database;
+// queue leases keep them from processing the same transaction.
+func runWorker(ctx context.Context, log *zap.Logger, args []string) error {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	cf := config.RegisterFlags(fs)
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9091 (default: off)")
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected argument %q", errUsage, fs.Arg(0))
+	}
+	cfg, err := cf.Load()
+	if err != nil {
+		return err
+	}
+
+	telemetry.InitMetrics()
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		srv := &http.Server{Addr: *metricsAddr, Handler: mux}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error("metrics server error", zap.Error(err))
+			}
+		}()
+		defer srv.Close()
+	}
+
+	ps, err := openPostgres(log, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer ps.DB.Close()
+
+	evVal, err := kafkapkg.NewValidator()
+	if err != nil {
+		return fmt.Errorf("schema validator init: %w", err)
+	}
+	worker := newWorker(log, ps, evVal, cfg.Worker)
+
+	done := make(chan struct{})
+	if prod := newProducer(log, cfg.Kafka); prod != nil {
+		defer prod.Close()
+		relay := outbox.NewRelay(log, ps, prod, cfg.Relay)
+		go func() {
+			relay.Run(ctx)
+			close(done)
+		}()
+	} else {
+		log.Warn("outbox relay disabled; events stay in the outbox until Kafka is configured")
+		close(done)
+	}
+
+	// returns once SIGINT/SIGTERM cancels ctx
+	worker.Run(ctx)
+	<-done
+	return nil
+}
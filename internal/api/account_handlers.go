@@ -0,0 +1,426 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/auth"
+	"github.com/AgentTarik/finance-api/internal/mail"
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+	mailTimeout      = 30 * time.Second
+)
+
+// mailActionToken issues a token for purpose and mails it to u in the
+// background, so the response time does not reveal whether it was sent.
+func (h *AuthHandlers) mailActionToken(u *storage.UserAuth, purpose string, ttl time.Duration) {
+	if h.Mailer == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		token, id, exp, err := h.ActionTokens.Issue(purpose, u.ID, u.Email, ttl)
+		if err == nil {
+			err = h.Accounts.CreateActionToken(ctx, storage.ActionToken{
+				ID: id, UserID: u.ID, Purpose: purpose, ExpiresAt: exp,
+			})
+		}
+		if err == nil {
+			err = h.Mailer.Send(ctx, h.actionMessage(u, purpose, token, ttl))
+		}
+		if err != nil {
+			h.Log.Error("account email failed",
+				zap.String("purpose", purpose),
+				zap.String("user_id", u.ID.String()),
+				zap.Error(err))
+		}
+	}()
+}
+
+func (h *AuthHandlers) actionMessage(u *storage.UserAuth, purpose, token string, ttl time.Duration) mail.Message {
+	link := func(prefix string) string {
+		if prefix == "" {
+			return "Token: " + token
+		}
+		return prefix + url.QueryEscape(token)
+	}
+	if purpose == auth.PurposeResetPassword {
+		return mail.Message{
+			To:      u.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nUse this to choose a new password (valid for %s):\n\n%s\n\n"+
+				"If you did not ask for a password reset, ignore this email.\n",
+				u.Name, ttl, link(h.Account.ResetPasswordURL)),
+		}
+	}
+	return mail.Message{
+		To:      u.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address (valid for %s):\n\n%s\n",
+			u.Name, ttl, link(h.Account.VerifyEmailURL)),
+	}
+}
+
+// sendVerificationEmail mails u a link that verifies their email.
+func (h *AuthHandlers) sendVerificationEmail(u *storage.UserAuth) {
+	h.mailActionToken(u, auth.PurposeVerifyEmail, verifyEmailTTL)
+}
+
+// notifyEmailChanged tells the previous address of u that the account now
+// uses another one, so an unexpected change does not go unnoticed.
+func (h *AuthHandlers) notifyEmailChanged(u *storage.UserAuth, oldEmail string) {
+	if h.Mailer == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		err := h.Mailer.Send(ctx, mail.Message{
+			To:      oldEmail,
+			Subject: "Your email address was changed",
+			Body: fmt.Sprintf("Hi %s,\n\nThe email address of your account was changed to %s.\n\n"+
+				"If you did not make this change, contact support.\n", u.Name, u.Email),
+		})
+		if err != nil {
+			h.Log.Error("email change notice failed", zap.String("user_id", u.ID.String()), zap.Error(err))
+		}
+	}()
+}
+
+// spendActionToken verifies token for purpose and spends it, returning its
+// user. Tokens mailed to an address the user no longer has are refused. It
+// answers 400 itself and returns false when the token is unusable.
+func (h *AuthHandlers) spendActionToken(c *gin.Context, purpose, token string) (*storage.UserAuth, bool) {
+	ctx := c.Request.Context()
+	uid, email, id, err := h.ActionTokens.Parse(purpose, token)
+	if err == nil {
+		var owner uuid.UUID
+		owner, err = h.Accounts.UseActionToken(ctx, id, purpose)
+		if err == nil && owner != uid {
+			err = auth.ErrActionTokenInvalid
+		}
+	}
+	var u *storage.UserAuth
+	if err == nil {
+		u, err = h.UsersDB.GetUserAuthByID(ctx, uid)
+	}
+	if err == nil && u.Deactivated {
+		err = storage.ErrUserNotFound
+	}
+	if err == nil && !strings.EqualFold(u.Email, email) {
+		err = auth.ErrActionTokenInvalid
+	}
+	switch {
+	case err == nil:
+		return u, true
+	case errors.Is(err, auth.ErrActionTokenInvalid),
+		errors.Is(err, storage.ErrActionTokenUsed),
+		errors.Is(err, storage.ErrUserNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid, expired or used token"})
+	default:
+		h.Log.Error("action token check failed", zap.String("purpose", purpose), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token check failed"})
+	}
+	return nil, false
+}
+
+// RequestEmailVerification godoc
+// @Summary      Resend the email verification link
+// @Description  Mails a new verification link to the authenticated user; earlier links stop working once one is used.
+// @Tags         auth
+// @Security     BearerAuth
+// @Param        Authorization header string true "Bearer <access token>"
+// @Success      202
+// @Failure      409      {object}  map[string]string
+// @Router       /auth/verify-email/request [post]
+func (h *AuthHandlers) RequestEmailVerification(c *gin.Context) {
+	uid, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	u, err := h.UsersDB.GetUserAuthByID(c.Request.Context(), uid)
+	if err != nil {
+		h.Log.Error("verification user lookup failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "request failed"})
+		return
+	}
+	if u.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already verified"})
+		return
+	}
+	h.sendVerificationEmail(u)
+	c.Status(http.StatusAccepted)
+}
+
+// VerifyEmail godoc
+// @Summary      Verify the email address
+// @Description  Confirms the email with the mailed token, given as the token query parameter (link) or in the body.
+// @Tags         auth
+// @Accept       json
+// @Param        token    query     string              false  "Mailed token"
+// @Param        payload  body      ActionTokenRequest  false  "Mailed token"
+// @Success      204
+// @Failure      400      {object}  map[string]string
+// @Router       /auth/verify-email [post]
+func (h *AuthHandlers) VerifyEmail(c *gin.Context) {
+	req := ActionTokenRequest{Token: c.Query("token")}
+	if req.Token == "" && c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+			return
+		}
+	}
+	if err := h.V.Struct(req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "token is required"})
+		return
+	}
+
+	u, ok := h.spendActionToken(c, auth.PurposeVerifyEmail, req.Token)
+	if !ok {
+		return
+	}
+	if err := h.Accounts.MarkEmailVerified(c.Request.Context(), u.ID); err != nil {
+		h.Log.Error("email verification failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RequestPasswordReset godoc
+// @Summary      Request a password reset
+// @Description  Mails a password reset link when the email belongs to an account. The answer is the same either way.
+// @Tags         auth
+// @Accept       json
+// @Param        payload  body      PasswordResetRequest  true  "Account email"
+// @Success      202
+// @Failure      422      {object}  map[string]string
+// @Router       /auth/password-reset/request [post]
+func (h *AuthHandlers) RequestPasswordReset(c *gin.Context) {
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if err := h.V.Struct(req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "validation failed"})
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	u, err := h.UsersDB.GetUserAuthByEmail(c.Request.Context(), email)
+	if err == nil && !u.Deactivated {
+		h.mailActionToken(u, auth.PurposeResetPassword, resetPasswordTTL)
+	}
+	// same answer for unknown emails: do not reveal who has an account
+	c.Status(http.StatusAccepted)
+}
+
+// ResetPassword godoc
+// @Summary      Reset the password
+// @Description  Sets a new password with the mailed token and ends every session of the user. It also verifies the email, since the token was received there.
+// @Tags         auth
+// @Accept       json
+// @Param        payload  body      PasswordResetConfirmRequest  true  "Token and new password"
+// @Success      204
+// @Failure      400      {object}  map[string]string
+// @Router       /auth/password-reset/confirm [post]
+func (h *AuthHandlers) ResetPassword(c *gin.Context) {
+	var req PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if err := h.V.Struct(req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "validation failed"})
+		return
+	}
+
+	u, ok := h.spendActionToken(c, auth.PurposeResetPassword, req.Token)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	pwHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err == nil {
+		err = h.Accounts.SetPasswordHash(ctx, u.ID, string(pwHash))
+	}
+	if err == nil {
+		// whoever knew the old password must not stay logged in
+		err = h.Sessions.RevokeUserRefreshTokens(ctx, u.ID)
+	}
+	if err == nil {
+		err = h.Sessions.RevokeUserAccessTokens(ctx, u.ID)
+	}
+	if err == nil {
+		err = h.Accounts.MarkEmailVerified(ctx, u.ID)
+	}
+	if err != nil {
+		h.Log.Error("password reset failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "reset failed"})
+		return
+	}
+	if h.Guard != nil {
+		if err := h.Guard.Unlock(ctx, storage.LoginByEmail, u.Email); err != nil {
+			h.Log.Error("login unlock after reset failed", zap.Error(err))
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// confirmPassword re-checks the caller's password before a sensitive
+// change. Wrong passwords count as failed logins, so a stolen access token
+// cannot be used to guess it. It answers itself and returns false on failure.
+func (h *AuthHandlers) confirmPassword(c *gin.Context, password string) (*storage.UserAuth, bool) {
+	uid, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+	ctx := c.Request.Context()
+	u, err := h.UsersDB.GetUserAuthByID(ctx, uid)
+	if err != nil {
+		h.Log.Error("password check user lookup failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return nil, false
+	}
+	ip := c.ClientIP()
+	if !h.checkThrottle(c, u.Email, ip) {
+		return nil, false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		if h.Guard != nil {
+			if err := h.Guard.Failure(ctx, u.Email, ip); err != nil {
+				h.Log.Error("login failure tracking failed", zap.Error(err))
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "incorrect password"})
+		return nil, false
+	}
+	return u, true
+}
+
+// ChangePassword godoc
+// @Summary      Change the password
+// @Description  Checks the current password, sets the new one and ends every other session. The answer carries a fresh token pair for the caller.
+// @Tags         users
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        payload  body      ChangePasswordRequest  true  "Current and new password"
+// @Success      200      {object}  map[string]any
+// @Failure      403      {object}  map[string]string
+// @Failure      422      {object}  map[string]string
+// @Router       /me/password [post]
+func (h *AuthHandlers) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if err := h.V.Struct(req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "validation failed"})
+		return
+	}
+	u, ok := h.confirmPassword(c, req.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	pwHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err == nil {
+		err = h.Accounts.SetPasswordHash(ctx, u.ID, string(pwHash))
+	}
+	if err == nil {
+		err = h.Sessions.RevokeUserRefreshTokens(ctx, u.ID)
+	}
+	if err == nil {
+		err = h.Sessions.RevokeUserAccessTokens(ctx, u.ID)
+	}
+	if err != nil {
+		h.Log.Error("password change failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "password change failed"})
+		return
+	}
+	h.Log.Info("password changed", zap.String("user_id", u.ID.String()))
+	h.startSession(c, u)
+}
+
+// DeactivateAccount godoc
+// @Summary      Deactivate the account
+// @Description  Soft-deletes the authenticated user after checking the password: login is blocked and every token and API key stops working. Transactions are kept.
+// @Tags         users
+// @Security     BearerAuth
+// @Accept       json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        payload  body      DeactivateAccountRequest  true  "Current password"
+// @Success      204
+// @Failure      403      {object}  map[string]string
+// @Router       /me [delete]
+func (h *AuthHandlers) DeactivateAccount(c *gin.Context) {
+	var req DeactivateAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if err := h.V.Struct(req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "validation failed"})
+		return
+	}
+	u, ok := h.confirmPassword(c, req.Password)
+	if !ok {
+		return
+	}
+	if err := h.UsersDB.DeactivateUser(c.Request.Context(), u.ID); err != nil {
+		h.Log.Error("account deactivation failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "deactivation failed"})
+		return
+	}
+	h.Log.Info("account deactivated", zap.String("user_id", u.ID.String()))
+	c.Status(http.StatusNoContent)
+}
+
+// RequireVerifiedEmail rejects users whose email is not verified yet, when
+// Account.RequireVerifiedEmail is set.
+func (h *AuthHandlers) RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.Account.RequireVerifiedEmail {
+			c.Next()
+			return
+		}
+		uid, ok := authUserID(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		verified, err := h.Accounts.EmailVerified(c.Request.Context(), uid)
+		if err != nil {
+			h.Log.Error("email verification lookup failed", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		if !verified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "email not verified"})
+			return
+		}
+		c.Next()
+	}
+}
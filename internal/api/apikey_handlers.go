@@ -0,0 +1,283 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/auth"
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// maxAPIKeysPerUser bounds how many live keys one user may hold.
+const maxAPIKeysPerUser = 20
+
+func toAPIKeyView(k storage.APIKey) APIKeyView {
+	return APIKeyView{
+		ID:         k.ID.String(),
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.Scopes,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
+
+// keyScopes checks that requested scopes are a non-empty subset of the
+// caller's own. It answers 422 and returns false otherwise.
+func keyScopes(c *gin.Context, requested []string) ([]string, bool) {
+	held := c.GetStringSlice("scopes")
+	if len(requested) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "scopes must not be empty"})
+		return nil, false
+	}
+	var out []string
+	for _, s := range requested {
+		if !slices.Contains(held, s) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "scope not held by the caller: " + s})
+			return nil, false
+		}
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out, true
+}
+
+// apiKeyTarget reads the caller and the :id path parameter.
+func apiKeyTarget(c *gin.Context) (uid, id uuid.UUID, ok bool) {
+	uid, ok = authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return uid, id, false
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return uid, id, false
+	}
+	return uid, id, true
+}
+
+func (h *AuthHandlers) apiKeyError(c *gin.Context, op string, err error) {
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	h.Log.Error("api key "+op+" failed", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "api key " + op + " failed"})
+}
+
+// CreateAPIKey godoc
+// @Summary      Create an API key
+// @Description  Creates an API key for machine-to-machine clients, sent as X-API-Key or "Authorization: ApiKey <key>". The key is only returned here. Its scopes must be held by the caller (default: all of them).
+// @Tags         api-keys
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        payload  body      CreateAPIKeyRequest  true  "Key settings"
+// @Success      201      {object}  CreatedAPIKeyResponse
+// @Failure      409      {object}  map[string]string
+// @Failure      422      {object}  map[string]string
+// @Router       /api-keys [post]
+func (h *AuthHandlers) CreateAPIKey(c *gin.Context) {
+	uid, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if err := h.V.Struct(req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "validation failed"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+	// no scopes requested: the key gets every scope the caller holds. Only
+	// creation defaults this way; an update never widens a key implicitly.
+	scopes := c.GetStringSlice("scopes")
+	if len(req.Scopes) > 0 {
+		if scopes, ok = keyScopes(c, req.Scopes); !ok {
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	existing, err := h.APIKeys.ListAPIKeys(ctx, uid)
+	if err != nil {
+		h.apiKeyError(c, "create", err)
+		return
+	}
+	if len(existing) >= maxAPIKeysPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "too many api keys; revoke one first"})
+		return
+	}
+
+	key, prefix, hash, err := auth.NewAPIKey()
+	k := storage.APIKey{
+		ID:        uuid.New(),
+		UserID:    uid,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err == nil {
+		err = h.APIKeys.CreateAPIKey(ctx, k)
+	}
+	if err != nil {
+		h.apiKeyError(c, "create", err)
+		return
+	}
+	h.Log.Info("api key created",
+		zap.String("user_id", uid.String()),
+		zap.String("key_id", k.ID.String()),
+		zap.String("prefix", prefix))
+	c.JSON(http.StatusCreated, CreatedAPIKeyResponse{APIKeyView: toAPIKeyView(k), Key: key})
+}
+
+// ListAPIKeys godoc
+// @Summary      List API keys
+// @Description  The caller's API keys that are not revoked (expired ones included).
+// @Tags         api-keys
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Success      200      {array}   APIKeyView
+// @Router       /api-keys [get]
+func (h *AuthHandlers) ListAPIKeys(c *gin.Context) {
+	uid, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	keys, err := h.APIKeys.ListAPIKeys(c.Request.Context(), uid)
+	if err != nil {
+		h.apiKeyError(c, "list", err)
+		return
+	}
+	out := make([]APIKeyView, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, toAPIKeyView(k))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GetAPIKey godoc
+// @Summary      Get an API key
+// @Tags         api-keys
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        id       path      string  true  "Key ID"
+// @Success      200      {object}  APIKeyView
+// @Failure      404      {object}  map[string]string
+// @Router       /api-keys/{id} [get]
+func (h *AuthHandlers) GetAPIKey(c *gin.Context) {
+	uid, id, ok := apiKeyTarget(c)
+	if !ok {
+		return
+	}
+	k, err := h.APIKeys.GetAPIKey(c.Request.Context(), uid, id)
+	if err != nil {
+		h.apiKeyError(c, "lookup", err)
+		return
+	}
+	c.JSON(http.StatusOK, toAPIKeyView(k))
+}
+
+// UpdateAPIKey godoc
+// @Summary      Update an API key
+// @Description  Renames a key or changes its scopes or expiry; omitted fields are kept. Scopes, when given, must be a non-empty subset of the caller's.
+// @Tags         api-keys
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        id       path      string               true  "Key ID"
+// @Param        payload  body      UpdateAPIKeyRequest  true  "Changes"
+// @Success      200      {object}  APIKeyView
+// @Failure      404      {object}  map[string]string
+// @Failure      422      {object}  map[string]string
+// @Router       /api-keys/{id} [patch]
+func (h *AuthHandlers) UpdateAPIKey(c *gin.Context) {
+	uid, id, ok := apiKeyTarget(c)
+	if !ok {
+		return
+	}
+	var req UpdateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if err := h.V.Struct(req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "validation failed"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	k, err := h.APIKeys.GetAPIKey(ctx, uid, id)
+	if err != nil {
+		h.apiKeyError(c, "update", err)
+		return
+	}
+	if req.Name != nil {
+		k.Name = *req.Name
+	}
+	if req.Scopes != nil {
+		if k.Scopes, ok = keyScopes(c, req.Scopes); !ok {
+			return
+		}
+	}
+	if req.ExpiresAt != nil {
+		k.ExpiresAt = req.ExpiresAt
+	}
+	if err := h.APIKeys.UpdateAPIKey(ctx, k); err != nil {
+		h.apiKeyError(c, "update", err)
+		return
+	}
+	c.JSON(http.StatusOK, toAPIKeyView(k))
+}
+
+// RevokeAPIKey godoc
+// @Summary      Revoke an API key
+// @Description  The key stops working immediately.
+// @Tags         api-keys
+// @Security     BearerAuth
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        id       path      string  true  "Key ID"
+// @Success      204
+// @Failure      404      {object}  map[string]string
+// @Router       /api-keys/{id} [delete]
+func (h *AuthHandlers) RevokeAPIKey(c *gin.Context) {
+	uid, id, ok := apiKeyTarget(c)
+	if !ok {
+		return
+	}
+	if err := h.APIKeys.RevokeAPIKey(c.Request.Context(), uid, id); err != nil {
+		h.apiKeyError(c, "revoke", err)
+		return
+	}
+	h.Log.Info("api key revoked",
+		zap.String("user_id", uid.String()),
+		zap.String("key_id", id.String()))
+	c.Status(http.StatusNoContent)
+}
@@ -2,35 +2,58 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/AgentTarik/finance-api/internal/auth"
+	"github.com/AgentTarik/finance-api/internal/config"
+	"github.com/AgentTarik/finance-api/internal/mail"
 	"github.com/AgentTarik/finance-api/internal/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // TokenIssuer abstracts JWT emission.
 type TokenIssuer interface {
-	Issue(userID string) (string, time.Time, error)
+	Issue(userID, role string, scopes []string) (string, time.Time, error)
+	RefreshTTL() time.Duration
 }
 
-// AuthHandlers handles register/login.
+// AuthHandlers handles register/login and the token lifecycle.
 type AuthHandlers struct {
-	Log     *zap.Logger
-	UsersDB *storage.PostgresStore
-	V       *validator.Validate
-	Tokens  TokenIssuer
-}
+	Log      *zap.Logger
+	UsersDB  storage.UserRepo
+	V        *validator.Validate
+	Tokens   TokenIssuer
+	JWT      config.JWT         // issuer, audience and leeway checked by RequireAuth
+	Keys     *auth.KeySet       // verification keys, published as JWKS
+	Sessions storage.TokenRepo  // refresh tokens and revocations
+	Guard    *auth.LoginGuard   // nil disables login throttling
+	MFA      storage.MFARepo    // nil disables two-factor login
+	APIKeys  storage.APIKeyRepo // nil disables API key auth
+	// TOTPIssuer names the service in authenticator apps.
+	TOTPIssuer string
 
+	// email verification and password reset
+	Accounts     storage.AccountRepo
+	ActionTokens *auth.ActionTokens
+	Mailer       mail.Mailer // nil: no emails, so neither flow can complete
+	// Account holds the link prefixes of mailed tokens and whether users
+	// with an unverified email may create transactions.
+	Account config.Account
+}
 
 // Register godoc
 // @Summary      Register a new user
-// @Description  Creates a user account.
+// @Description  Creates a user account. The id is optional; the server generates one (UUIDv7) when it is omitted.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -50,25 +73,40 @@ func (h *AuthHandlers) Register(c *gin.Context) {
 		return
 	}
 
-	id, _ := uuid.Parse(req.ID)
+	var id uuid.UUID // zero: the store generates one
+	if req.ID != "" {
+		id, _ = uuid.Parse(req.ID)
+	}
 	email := strings.ToLower(strings.TrimSpace(req.Email))
-	pwHash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	pwHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		h.Log.Error("password hash failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "register failed"})
+		return
+	}
 
-	if err := h.UsersDB.CreateUserWithCredentials(c.Request.Context(), id, req.Name, email, string(pwHash)); err != nil {
-		// For simplicity, collapse to 409 on uniqueness errors; refine with pq error codes if you want.
-		h.Log.Warn("register failed", zap.Error(err))
+	u, err := h.UsersDB.CreateUser(c.Request.Context(), storage.NewUser{
+		ID: id, Name: req.Name, Email: email, PasswordHash: string(pwHash),
+	})
+	switch {
+	case errors.Is(err, storage.ErrUserAlreadyExists), errors.Is(err, storage.ErrEmailTaken):
 		c.JSON(http.StatusConflict, gin.H{"error": "user already exists"})
 		return
+	case err != nil:
+		h.Log.Error("register failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "register failed"})
+		return
 	}
 
+	h.sendVerificationEmail(&storage.UserAuth{ID: u.ID, Name: u.Name, Email: u.Email})
+
 	c.JSON(http.StatusCreated, gin.H{
-		"id":    id.String(),
-		"name":  req.Name,
+		"id":    u.ID.String(),
+		"name":  u.Name,
 		"email": email,
 	})
 }
 
-
 // Login godoc
 // @Summary      Login with email and password
 // @Description  Returns a short-lived JWT access token.
@@ -93,31 +131,303 @@ func (h *AuthHandlers) Login(c *gin.Context) {
 
 	ctx := context.Background()
 	email := strings.ToLower(strings.TrimSpace(req.Email))
+	ip := c.ClientIP()
+	if !h.checkThrottle(c, email, ip) {
+		return
+	}
+
 	u, err := h.UsersDB.GetUserAuthByEmail(ctx, email)
+	if err == nil && bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)) != nil {
+		err = errors.New("password mismatch")
+	}
 	if err != nil {
+		if h.Guard != nil {
+			if gerr := h.Guard.Failure(ctx, email, ip); gerr != nil {
+				h.Log.Error("login failure tracking failed", zap.Error(gerr))
+			}
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
-	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)) != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+	if h.Guard != nil {
+		if err := h.Guard.Success(ctx, u, ip); err != nil {
+			h.Log.Error("login success tracking failed", zap.Error(err))
+		}
+	}
+	if u.Deactivated {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account deactivated"})
+		return
+	}
+
+	if u.TOTPEnabled && h.MFA != nil {
+		h.startChallenge(c, u)
 		return
 	}
+	h.startSession(c, u)
+}
+
+// checkThrottle answers 429 (with Retry-After) and returns false when a
+// login for email from ip is throttled or locked out.
+func (h *AuthHandlers) checkThrottle(c *gin.Context, email, ip string) bool {
+	if h.Guard == nil {
+		return true
+	}
+	err := h.Guard.Check(c.Request.Context(), email, ip)
+	if err == nil {
+		return true
+	}
+	var te *auth.ThrottledError
+	if errors.As(err, &te) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(te.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": te.Error()})
+		return false
+	}
+	h.Log.Error("login throttle check failed", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+	return false
+}
 
-	token, exp, err := h.Tokens.Issue(u.ID.String())
+// startSession opens a session for an authenticated user: a new refresh
+// token family plus an access token.
+func (h *AuthHandlers) startSession(c *gin.Context, u *storage.UserAuth) {
+	body, err := h.newSession(c.Request.Context(), u)
 	if err != nil {
-		h.Log.Error("jwt issue failed", zap.Error(err))
+		h.Log.Error("token issue failed", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "token issue failed"})
 		return
 	}
+	c.JSON(http.StatusOK, body)
+}
+
+// newSession starts a new session for u and returns the token response body.
+func (h *AuthHandlers) newSession(ctx context.Context, u *storage.UserAuth) (gin.H, error) {
+	// each login starts a new refresh token family (session)
+	refresh, hash, err := auth.NewOpaqueToken()
+	if err == nil {
+		err = h.Sessions.CreateRefreshToken(ctx, storage.RefreshToken{
+			ID:        uuid.New(),
+			FamilyID:  uuid.New(),
+			UserID:    u.ID,
+			TokenHash: hash,
+			ExpiresAt: time.Now().Add(h.Tokens.RefreshTTL()),
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("refresh token: %w", err)
+	}
+	return h.tokenBody(u, refresh)
+}
+
+// respondTokens mints an access token for u and answers with it and the
+// given refresh token.
+func (h *AuthHandlers) respondTokens(c *gin.Context, u *storage.UserAuth, refresh string) {
+	body, err := h.tokenBody(u, refresh)
+	if err != nil {
+		h.Log.Error("token issue failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token issue failed"})
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// tokenBody mints an access token for u and returns it with the given
+// refresh token as a response body.
+func (h *AuthHandlers) tokenBody(u *storage.UserAuth, refresh string) (gin.H, error) {
+	scopes := auth.ScopesFor(u.Role, u.Scopes)
+	token, exp, err := h.Tokens.Issue(u.ID.String(), u.Role, scopes)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %w", err)
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token": token,
-		"token_type":   "Bearer",
-		"expires_in":   int(exp.Sub(time.Now()).Seconds()),
+	return gin.H{
+		"access_token":       token,
+		"token_type":         "Bearer",
+		"expires_in":         int(exp.Sub(time.Now()).Seconds()),
+		"scope":              strings.Join(scopes, " "),
+		"refresh_token":      refresh,
+		"refresh_expires_in": int(h.Tokens.RefreshTTL().Seconds()),
 		"user": gin.H{
-			"id":    u.ID.String(),
-			"name":  u.Name,
-			"email": u.Email,
+			"id":             u.ID.String(),
+			"name":           u.Name,
+			"email":          u.Email,
+			"role":           u.Role,
+			"email_verified": u.EmailVerified,
 		},
+	}, nil
+}
+
+// Refresh godoc
+// @Summary      Refresh the access token
+// @Description  Exchanges a refresh token for a new access token and a new refresh token. Refresh tokens are single use; presenting one twice revokes the whole session.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      RefreshRequest  true  "Refresh payload"
+// @Success      200      {object}  map[string]any
+// @Failure      400      {object}  map[string]string
+// @Failure      401      {object}  map[string]string
+// @Router       /auth/refresh [post]
+func (h *AuthHandlers) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if err := h.V.Struct(req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "validation failed"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	refresh, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		h.Log.Error("refresh token issue failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token issue failed"})
+		return
+	}
+	spent, err := h.Sessions.RotateRefreshToken(ctx, auth.HashOpaqueToken(req.RefreshToken), storage.RefreshToken{
+		ID:        uuid.New(),
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(h.Tokens.RefreshTTL()),
 	})
+	switch {
+	case errors.Is(err, storage.ErrRefreshTokenReused):
+		h.Log.Warn("refresh token reuse detected; session revoked",
+			zap.String("user_id", spent.UserID.String()),
+			zap.String("family_id", spent.FamilyID.String()))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reused; session revoked"})
+		return
+	case errors.Is(err, storage.ErrRefreshTokenInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	case err != nil:
+		h.Log.Error("refresh token rotation failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "refresh failed"})
+		return
+	}
+
+	// role and scopes may have changed since login: read them again
+	u, err := h.UsersDB.GetUserAuthByID(ctx, spent.UserID)
+	if err != nil {
+		h.Log.Error("refresh user lookup failed", zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+	h.respondTokens(c, u, refresh)
+}
+
+// Logout godoc
+// @Summary      Logout
+// @Description  Revokes the current access token. With refresh_token it also ends that session; with all=true it ends every session of the user.
+// @Tags         auth
+// @Security     BearerAuth
+// @Accept       json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        payload  body      LogoutRequest  false  "Logout payload"
+// @Success      204
+// @Failure      401      {object}  map[string]string
+// @Router       /auth/logout [post]
+func (h *AuthHandlers) Logout(c *gin.Context) {
+	var req LogoutRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+			return
+		}
+	}
+	uid, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	exp, _ := c.Get("token_exp")
+	expAt, _ := exp.(time.Time)
+	if err := h.Sessions.RevokeAccessToken(ctx, c.GetString("jti"), expAt); err != nil {
+		h.Log.Error("access token revoke failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "logout failed"})
+		return
+	}
+
+	var err error
+	switch {
+	case req.All:
+		err = h.Sessions.RevokeUserRefreshTokens(ctx, uid)
+	case req.RefreshToken != "":
+		var t storage.RefreshToken
+		t, err = h.Sessions.RefreshTokenByHash(ctx, auth.HashOpaqueToken(req.RefreshToken))
+		switch {
+		case errors.Is(err, storage.ErrRefreshTokenInvalid):
+			err = nil // unknown token: nothing to end
+		case err == nil && t.UserID == uid:
+			err = h.Sessions.RevokeRefreshFamily(ctx, t.FamilyID)
+		}
+	}
+	if err != nil {
+		h.Log.Error("refresh token revoke failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "logout failed"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// JWKS godoc
+// @Summary      JSON Web Key Set
+// @Description  Public keys that verify the access tokens issued by this service (asymmetric keys only).
+// @Tags         auth
+// @Produce      json
+// @Success      200      {object}  auth.JWKS
+// @Router       /.well-known/jwks.json [get]
+func (h *AuthHandlers) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.Keys.JWKS())
+}
+
+// UnlockLogin godoc
+// @Summary      Unlock logins
+// @Description  Lifts the lockout and clears the failed-login count of an email and/or a client IP.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        payload  body      UnlockLoginRequest  true  "Email and/or IP"
+// @Success      204
+// @Failure      422      {object}  map[string]string
+// @Router       /admin/login-locks/unlock [post]
+func (h *AuthHandlers) UnlockLogin(c *gin.Context) {
+	var req UnlockLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if err := h.V.Struct(req); err != nil || (req.Email == "" && req.IP == "") {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "email or ip is required"})
+		return
+	}
+	if h.Guard == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	ctx := c.Request.Context()
+	keys := map[string]string{
+		storage.LoginByEmail: strings.ToLower(strings.TrimSpace(req.Email)),
+		storage.LoginByIP:    strings.TrimSpace(req.IP),
+	}
+	for kind, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := h.Guard.Unlock(ctx, kind, key); err != nil {
+			h.Log.Error("login unlock failed", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unlock failed"})
+			return
+		}
+		h.Log.Info("login unlocked",
+			zap.String("kind", kind),
+			zap.String("key", key),
+			zap.String("by", c.GetString("user_id")))
+	}
+	c.Status(http.StatusNoContent)
 }
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// authUserID returns the authenticated user id set by the JWT middleware.
+func authUserID(c *gin.Context) (uuid.UUID, bool) {
+	v, ok := c.Get("user_id")
+	if !ok {
+		return uuid.Nil, false
+	}
+	s, _ := v.(string)
+	id, err := uuid.Parse(s)
+	return id, err == nil
+}
+
+// GetBalance godoc
+// @Summary      Account balance
+// @Description  Current balances of the authenticated user per currency, or the balances as of a past instant.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true  "Bearer <access token>"
+// @Param        id            path   string true  "User (account holder) id"
+// @Param        currency      query  string false "ISO-4217 currency filter"
+// @Param        at            query  string false "RFC3339 instant for a historical balance"
+// @Success      200      {object}  BalanceResponse
+// @Failure      400      {object}  map[string]string
+// @Failure      401      {object}  map[string]string
+// @Failure      404      {object}  map[string]string
+// @Router       /accounts/{id}/balance [get]
+func (h *Handlers) GetBalance(c *gin.Context) {
+	authID, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing auth context"})
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	// other users' accounts are reported as missing, not forbidden
+	if id != authID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return
+	}
+
+	var (
+		balances []storage.Balance
+		asOf     *time.Time
+	)
+	if raw := c.Query("at"); raw != "" {
+		at, perr := time.Parse(time.RFC3339, raw)
+		if perr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid at (RFC3339 expected)"})
+			return
+		}
+		asOf = &at
+		balances, err = h.Balances.UserBalancesAt(c.Request.Context(), id, at)
+	} else {
+		balances, err = h.Balances.UserBalances(c.Request.Context(), id)
+	}
+	if err != nil {
+		h.Log.Error("balance lookup failed", zap.Error(err), zap.String("user_id", id.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load balance"})
+		return
+	}
+
+	currency := strings.ToUpper(c.Query("currency"))
+	out := BalanceResponse{UserID: id.String(), AsOf: asOf, Balances: []BalanceView{}}
+	for _, b := range balances {
+		if currency != "" && b.Amount.Currency() != currency {
+			continue
+		}
+		out.Balances = append(out.Balances, BalanceView{
+			Currency:  b.Amount.Currency(),
+			Amount:    b.Amount.String(),
+			UpdatedAt: b.UpdatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, out)
+}
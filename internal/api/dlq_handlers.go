@@ -0,0 +1,168 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// EventValidator re-checks dead-lettered payloads before replaying them.
+type EventValidator interface {
+	Validate(v any) error
+}
+
+func toDeadLetterView(d storage.DeadLetter) DeadLetterView {
+	return DeadLetterView{
+		ID:          d.ID.String(),
+		Source:      d.Source,
+		AggregateID: d.AggregateID.String(),
+		EventType:   d.EventType,
+		Payload:     d.Payload,
+		Reason:      d.Reason,
+		Attempts:    d.Attempts,
+		Status:      d.Status,
+		CreatedAt:   d.CreatedAt,
+		ResolvedAt:  d.ResolvedAt,
+	}
+}
+
+func deadLetterError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrDeadLetterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, storage.ErrDeadLetterResolved):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "dead letter operation failed"})
+	}
+}
+
+// ListDeadLetters godoc
+// @Summary      List dead letters
+// @Description  Events that failed schema validation or publishing (admin only).
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true  "Bearer <access token>"
+// @Param        status        query  string false "open | replayed | discarded (default open)"
+// @Param        limit         query  int    false "max entries (default 50, max 500)"
+// @Success      200      {array}   DeadLetterView
+// @Failure      401      {object}  map[string]string
+// @Failure      403      {object}  map[string]string
+// @Router       /admin/dlq [get]
+func (h *Handlers) ListDeadLetters(c *gin.Context) {
+	status := c.DefaultQuery("status", storage.DeadLetterOpen)
+	if status == "all" {
+		status = ""
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	dls, err := h.DeadLetters.ListDeadLetters(c.Request.Context(), status, limit)
+	if err != nil {
+		h.Log.Error("dlq list failed", zap.Error(err))
+		deadLetterError(c, err)
+		return
+	}
+	out := make([]DeadLetterView, 0, len(dls))
+	for _, d := range dls {
+		out = append(out, toDeadLetterView(d))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GetDeadLetter godoc
+// @Summary      Inspect a dead letter
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        id            path   string true "Dead letter id"
+// @Success      200      {object}  DeadLetterView
+// @Failure      404      {object}  map[string]string
+// @Router       /admin/dlq/{id} [get]
+func (h *Handlers) GetDeadLetter(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	d, err := h.DeadLetters.GetDeadLetter(c.Request.Context(), id)
+	if err != nil {
+		deadLetterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toDeadLetterView(d))
+}
+
+// ReplayDeadLetter godoc
+// @Summary      Replay a dead letter
+// @Description  Puts the event back into the outbox. Schema rejects are re-validated first.
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        id            path   string true "Dead letter id"
+// @Success      202      {object}  map[string]string
+// @Failure      404      {object}  map[string]string
+// @Failure      409      {object}  map[string]string
+// @Failure      422      {object}  map[string]string
+// @Router       /admin/dlq/{id}/replay [post]
+func (h *Handlers) ReplayDeadLetter(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	ctx := c.Request.Context()
+	d, err := h.DeadLetters.GetDeadLetter(ctx, id)
+	if err != nil {
+		deadLetterError(c, err)
+		return
+	}
+	if d.Source == storage.DeadLetterSchema && h.Events != nil {
+		if err := h.Events.Validate(d.Payload); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "payload still fails schema validation: " + err.Error()})
+			return
+		}
+	}
+	if err := h.DeadLetters.ReplayDeadLetter(ctx, id); err != nil {
+		h.Log.Error("dlq replay failed", zap.Error(err), zap.String("id", id.String()))
+		deadLetterError(c, err)
+		return
+	}
+	h.Log.Info("dlq replayed", zap.String("id", id.String()), zap.String("by", c.GetString("user_id")))
+	c.JSON(http.StatusAccepted, gin.H{"id": id.String(), "status": storage.DeadLetterReplayed})
+}
+
+// DiscardDeadLetter godoc
+// @Summary      Discard a dead letter
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        id            path   string true "Dead letter id"
+// @Success      200      {object}  map[string]string
+// @Failure      404      {object}  map[string]string
+// @Failure      409      {object}  map[string]string
+// @Router       /admin/dlq/{id}/discard [post]
+func (h *Handlers) DiscardDeadLetter(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := h.DeadLetters.DiscardDeadLetter(c.Request.Context(), id); err != nil {
+		deadLetterError(c, err)
+		return
+	}
+	h.Log.Info("dlq discarded", zap.String("id", id.String()), zap.String("by", c.GetString("user_id")))
+	c.JSON(http.StatusOK, gin.H{"id": id.String(), "status": storage.DeadLetterDiscarded})
+}
@@ -1,9 +1,12 @@
 package api
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type RegisterRequest struct {
-	ID       string `json:"id" validate:"required,uuid4"`
+	ID       string `json:"id" validate:"omitempty,uuid"` // opcional; gerado pelo servidor (UUIDv7) se ausente
 	Name     string `json:"name" validate:"required,min=2"`
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8"`
@@ -14,6 +17,50 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required,min=8"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// Logout: refresh_token opcional encerra também a sessão de refresh;
+// all=true revoga todas as sessões do usuário
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all"`
+}
+
+// Desbloqueio de login (admin): email e/ou IP
+type UnlockLoginRequest struct {
+	Email string `json:"email" validate:"omitempty,email"`
+	IP    string `json:"ip"    validate:"omitempty,ip"`
+}
+
+// Código de 2FA: TOTP (6 dígitos) ou código de recuperação
+type TOTPCodeRequest struct {
+	Code         string `json:"code"          validate:"omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"omitempty,max=32"`
+}
+
+// Segundo passo do login com 2FA
+type LoginTOTPRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	TOTPCodeRequest
+}
+
+// Token recebido por email (verificação de email)
+type ActionTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// Pedido de redefinição de senha
+type PasswordResetRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// Redefinição de senha com o token recebido por email
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token"    validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
 
 // Entrada para criar usuário
 type CreateUserRequest struct {
@@ -27,19 +74,166 @@ type UserResponse struct {
 	Name string `json:"name"`
 }
 
+// Perfil do usuário autenticado (/v1/me)
+type MeResponse struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          string    `json:"role"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Alteração de perfil (campos ausentes ficam como estão);
+// trocar o email exige a senha atual e verificá-lo de novo
+type UpdateMeRequest struct {
+	Name            *string `json:"name"             validate:"omitempty,min=2,max=80"`
+	Email           *string `json:"email"            validate:"omitempty,email"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+// Troca de senha: exige a senha atual
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password"     validate:"required,min=8"`
+}
+
+// Desativação da conta: exige a senha atual
+type DeactivateAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
 // Entrada para criar transação
 type CreateTransactionRequest struct {
-	TransactionID string  `json:"transaction_id" validate:"required,uuid4"` // UUID v4
-	Amount        float64 `json:"amount" validate:"required,gt=0"`
-	// valor
-	Timestamp string `json:"timestamp"      validate:"required,datetime=2006-01-02T15:04:05Z07:00"` // RFC3339
+	TransactionID string `json:"transaction_id" validate:"required,uuid4"`                              // UUID v4
+	Amount        string `json:"amount"         validate:"required,amount" example:"12.34"`             // valor decimal exato
+	Currency      string `json:"currency"       validate:"required,iso4217" example:"BRL"`              // ISO-4217
+	Timestamp     string `json:"timestamp"      validate:"required,datetime=2006-01-02T15:04:05Z07:00"` // RFC3339
+	Category      string `json:"category"       validate:"omitempty,max=64" example:"groceries"`        // opcional
 }
 
 // Saída de transação
 type Transaction struct {
-	TransactionID string    `json:"transaction_id"`
-	UserID        string    `json:"user_id"`
-	Amount        float64   `json:"amount"`
-	Timestamp     time.Time `json:"timestamp"`
-	Status        string    `json:"status"` // queued | processed | failed
+	TransactionID string     `json:"transaction_id"`
+	UserID        string     `json:"user_id"`
+	Amount        string     `json:"amount"`
+	Currency      string     `json:"currency"`
+	Timestamp     time.Time  `json:"timestamp"`
+	Category      string     `json:"category,omitempty"`
+	Status        string     `json:"status"` // queued | processed | failed | reversed | cancelled
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	ProcessedAt   *time.Time `json:"processed_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"` // último erro de processamento
+}
+
+// Página de transações (paginação por cursor)
+type TransactionPage struct {
+	Items      []Transaction `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"` // vazio na última página
+}
+
+// Linha agregada de um relatório (por moeda)
+type ReportRowView struct {
+	Group       string     `json:"group,omitempty"`        // status, categoria ou usuário (breakdowns)
+	BucketStart *time.Time `json:"bucket_start,omitempty"` // início do intervalo (séries temporais)
+	Currency    string     `json:"currency"`
+	Count       int64      `json:"count"`
+	Total       string     `json:"total"`
+	Min         string     `json:"min"`
+	Max         string     `json:"max"`
+	Avg         string     `json:"avg"` // arredondado a 4 casas
+}
+
+// Resposta de /v1/reports
+type ReportResponse struct {
+	UserID     string                     `json:"user_id,omitempty"` // vazio quando agrega todos os usuários
+	From       *time.Time                 `json:"from,omitempty"`
+	To         *time.Time                 `json:"to,omitempty"`
+	Timezone   string                     `json:"timezone"`
+	Status     string                     `json:"status,omitempty"`
+	Totals     []ReportRowView            `json:"totals"`
+	Bucket     string                     `json:"bucket,omitempty"` // day | week | month
+	Buckets    []ReportRowView            `json:"buckets,omitempty"`
+	Breakdowns map[string][]ReportRowView `json:"breakdowns,omitempty"` // status | category | user
+}
+
+// Saldo em uma moeda
+type BalanceView struct {
+	Currency  string    `json:"currency"`
+	Amount    string    `json:"amount"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Saldos de um usuário (atual ou em um instante passado)
+type BalanceResponse struct {
+	UserID   string        `json:"user_id"`
+	AsOf     *time.Time    `json:"as_of,omitempty"`
+	Balances []BalanceView `json:"balances"`
+}
+
+// Entrada da fila de dead-letter (admin)
+type DeadLetterView struct {
+	ID          string          `json:"id"`
+	Source      string          `json:"source"` // schema | publish
+	AggregateID string          `json:"aggregate_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload" swaggertype:"object"`
+	Reason      string          `json:"reason"`
+	Attempts    int             `json:"attempts"`
+	Status      string          `json:"status"` // open | replayed | discarded
+	CreatedAt   time.Time       `json:"created_at"`
+	ResolvedAt  *time.Time      `json:"resolved_at,omitempty"`
+}
+
+// Transição de status de uma transação
+type StatusChangeView struct {
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Transação com histórico de status
+type TransactionDetail struct {
+	Transaction
+	History []StatusChangeView `json:"history"`
+}
+
+// Motivo de uma mudança de status manual
+type StatusChangeRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// Criação de chave de API; scopes vazios = escopos atuais do usuário
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"       validate:"required,max=80"`
+	Scopes    []string   `json:"scopes"     validate:"omitempty,dive,required"`
+	ExpiresAt *time.Time `json:"expires_at"` // opcional; sem expiração se ausente
+}
+
+// Alteração de chave de API (campos ausentes ficam como estão);
+// scopes, se presentes, não podem ser vazios
+type UpdateAPIKeyRequest struct {
+	Name      *string    `json:"name"       validate:"omitempty,min=1,max=80"`
+	Scopes    []string   `json:"scopes"     validate:"omitempty,min=1,dive,required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Chave de API (sem o segredo)
+type APIKeyView struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // início da chave, para identificá-la
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Chave recém-criada: o segredo só aparece nesta resposta
+type CreatedAPIKeyResponse struct {
+	APIKeyView
+	Key string `json:"key"`
 }
@@ -2,10 +2,18 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/AgentTarik/finance-api/internal/auth"
+	"github.com/AgentTarik/finance-api/internal/config"
+	"github.com/AgentTarik/finance-api/internal/money"
 	"github.com/AgentTarik/finance-api/internal/storage"
+	txworker "github.com/AgentTarik/finance-api/internal/transaction"
 	"github.com/AgentTarik/finance-api/telemetry"
 
 	"github.com/gin-gonic/gin"
@@ -15,14 +23,23 @@ import (
 )
 
 type Handlers struct {
-	Log          *zap.Logger
-	Users        storage.UserRepo
-	TxRepo       storage.TxRepo
-	V            *validator.Validate
-	DBPing       func(ctx context.Context) error
-	KafkaEnabled bool
-
-	// Enqueuer function (send to worker)
+	Log         *zap.Logger
+	Users       storage.UserRepo
+	TxRepo      storage.TxRepo
+	Statuses    storage.StatusRepo
+	Ledger      storage.LedgerRepo
+	Balances    storage.BalanceRepo
+	Reporting   storage.ReportRepo
+	DeadLetters storage.DeadLetterRepo
+	IdemKeys    storage.IdempotencyRepo // nil disables Idempotency-Key support
+	Events      EventValidator          // can be nil
+	V           *validator.Validate
+	DBPing      func(ctx context.Context) error
+	Kafka       config.Kafka // read by /kafka/poll; Health reports whether it is set
+
+	// Admit applies queue backpressure before a transaction is accepted
+	// (nil: always admit); Enqueue wakes the worker once it is persisted.
+	Admit   func(context.Context) error
 	Enqueue func(storage.Transaction)
 	Auth    *AuthHandlers
 }
@@ -45,12 +62,24 @@ func (h *Handlers) Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":        "ok",
 		"db":            db,
-		"kafka_enabled": h.KafkaEnabled,
+		"kafka_enabled": h.Kafka.Enabled(),
 	})
 }
 
 // user handler
 
+// GetUser godoc
+// @Summary      Get a user
+// @Description  Returns the authenticated user; admins may read any user.
+// @Tags         users
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        id       path      string  true  "User ID"
+// @Success      200      {object}  UserResponse
+// @Failure      401      {object}  map[string]string
+// @Failure      404      {object}  map[string]string
+// @Router       /users/{id} [get]
 func (h *Handlers) GetUser(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -58,8 +87,14 @@ func (h *Handlers) GetUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
+	// other users are reported as missing so ids cannot be probed
+	if authID, _ := authUserID(c); authID != id && !auth.HasScope(c, auth.ScopeAdminRead) {
+		telemetry.IncUsersGet(false)
+		c.JSON(http.StatusNotFound, gin.H{"error": storage.ErrUserNotFound.Error()})
+		return
+	}
 
-	u, err := h.Users.GetUser(id)
+	u, err := h.Users.GetUser(c.Request.Context(), id)
 	if err != nil {
 		status := http.StatusInternalServerError
 		if err == storage.ErrUserNotFound {
@@ -73,6 +108,119 @@ func (h *Handlers) GetUser(c *gin.Context) {
 	c.JSON(http.StatusOK, UserResponse{ID: u.ID.String(), Name: u.Name})
 }
 
+func toMeResponse(u storage.User, role string) MeResponse {
+	return MeResponse{
+		ID:            u.ID.String(),
+		Name:          u.Name,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Role:          role,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+	}
+}
+
+// GetMe godoc
+// @Summary      Current user
+// @Description  Profile of the authenticated user.
+// @Tags         users
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Success      200      {object}  MeResponse
+// @Failure      401      {object}  map[string]string
+// @Router       /me [get]
+func (h *Handlers) GetMe(c *gin.Context) {
+	uid, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	u, err := h.Users.GetUser(c.Request.Context(), uid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		h.Log.Error("profile lookup failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, toMeResponse(u, c.GetString("role")))
+}
+
+// UpdateMe godoc
+// @Summary      Update the current user
+// @Description  Changes the name and/or email. Changing the email needs current_password; the new one is unverified until the link mailed to it is followed, and the old one is told about the change.
+// @Tags         users
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        payload  body      UpdateMeRequest  true  "Changes"
+// @Success      200      {object}  MeResponse
+// @Failure      403      {object}  map[string]string
+// @Failure      409      {object}  map[string]string
+// @Failure      422      {object}  map[string]string
+// @Router       /me [patch]
+func (h *Handlers) UpdateMe(c *gin.Context) {
+	uid, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var req UpdateMeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if err := h.V.Struct(req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "validation failed"})
+		return
+	}
+	if req.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*req.Email))
+		req.Email = &email
+	}
+
+	before, err := h.Users.GetUser(c.Request.Context(), uid)
+	if err == nil && req.Email != nil && *req.Email != before.Email {
+		// the email is how a lost password is recovered: repointing it must
+		// take more than an access token
+		if h.Auth == nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "email changes are not available"})
+			return
+		}
+		if req.CurrentPassword == "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "current_password is required to change the email"})
+			return
+		}
+		if _, ok := h.Auth.confirmPassword(c, req.CurrentPassword); !ok {
+			return
+		}
+	}
+	var u storage.User
+	if err == nil {
+		u, err = h.Users.UpdateUser(c.Request.Context(), uid, storage.UserUpdate{Name: req.Name, Email: req.Email})
+	}
+	switch {
+	case err == nil:
+		if u.Email != before.Email && h.Auth != nil {
+			ua := &storage.UserAuth{ID: u.ID, Name: u.Name, Email: u.Email}
+			h.Auth.sendVerificationEmail(ua)
+			h.Auth.notifyEmailChanged(ua, before.Email)
+		}
+		c.JSON(http.StatusOK, toMeResponse(u, c.GetString("role")))
+	case errors.Is(err, storage.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, storage.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.Log.Error("profile update failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+	}
+}
+
 // CreateTransaction godoc
 // @Summary      Create a transaction
 // @Description  Enqueues a transaction; user is taken from JWT.
@@ -81,12 +229,15 @@ func (h *Handlers) GetUser(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        Authorization header string true "Bearer <access token>"
+// @Param        Idempotency-Key header string false "Unique key; retries with the same key replay the first response"
 // @Param        payload  body      CreateTransactionRequest  true  "Transaction payload"
 // @Success      202      {object}  map[string]string
 // @Failure      400      {object}  map[string]string
 // @Failure      401      {object}  map[string]string
+// @Failure      409      {object}  map[string]string
 // @Failure      422      {object}  map[string]string
 // @Failure      500      {object}  map[string]string
+// @Failure      503      {object}  map[string]string
 // @Router       /transactions [post]
 func (h *Handlers) CreateTransaction(c *gin.Context) {
 
@@ -125,81 +276,224 @@ func (h *Handlers) CreateTransaction(c *gin.Context) {
 		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid timestamp (RFC3339 expected)"})
 		return
 	}
+	amount, err := money.Parse(req.Amount, req.Currency)
+	if err != nil {
+		telemetry.IncTransactionsFailed("validation")
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
 
-	// store as queued
+	// backpressure: refuse new work instead of piling up an unbounded backlog
+	if h.Admit != nil {
+		if err := h.Admit(c.Request.Context()); err != nil {
+			if errors.Is(err, txworker.ErrQueueFull) {
+				telemetry.IncTransactionsFailed("backpressure")
+				c.Header("Retry-After", "5")
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "queue full, retry later"})
+				return
+			}
+			telemetry.IncTransactionsFailed("db")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check queue"})
+			return
+		}
+	}
+
+	// store as queued (durable: the worker claims it from the table)
 	t := storage.Transaction{
 		TransactionID: txID,
 		UserID:        authUserID,
-		Amount:        req.Amount,
+		Amount:        amount,
 		Timestamp:     ts,
-		Status:        "queued",
+		Category:      req.Category,
+		Status:        string(txworker.Queued),
 	}
-	if err := h.TxRepo.UpsertTx(t); err != nil {
+	if err := h.TxRepo.InsertTx(c.Request.Context(), t); err != nil {
+		if errors.Is(err, storage.ErrTxExists) {
+			h.existingTransaction(c, t)
+			return
+		}
 		telemetry.IncTransactionsFailed("db")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to persist"})
 		return
 	}
 
-	// ennqueue for async processing
+	// wake the worker for async processing
 	h.Enqueue(t)
 
 	c.JSON(http.StatusAccepted, gin.H{
 		"transaction_id": req.TransactionID,
-		"status":         "queued",
+		"status":         string(txworker.Queued),
+	})
+}
+
+// existingTransaction answers a create for an id that is already taken: an
+// identical retry gets the current status back, anything else is a
+// conflict. An id owned by another user is the same conflict, so ids cannot
+// be probed. Timestamps are compared at microsecond precision, the most
+// Postgres keeps. Existing rows are never overwritten.
+func (h *Handlers) existingTransaction(c *gin.Context, t storage.Transaction) {
+	cur, err := h.TxRepo.GetTxForUser(c.Request.Context(), t.UserID, t.TransactionID)
+	if err != nil && !errors.Is(err, storage.ErrTxNotFound) {
+		telemetry.IncTransactionsFailed("db")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to persist"})
+		return
+	}
+	if err != nil || cur.Amount != t.Amount || cur.Category != t.Category ||
+		!cur.Timestamp.Truncate(time.Microsecond).Equal(t.Timestamp.Truncate(time.Microsecond)) {
+		telemetry.IncTransactionsFailed("validation")
+		c.JSON(http.StatusConflict, gin.H{"error": "transaction_id already used with different data"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"transaction_id": cur.TransactionID.String(),
+		"status":         cur.Status,
 	})
 }
 
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// parseTxFilter reads the listing query parameters.
+func parseTxFilter(c *gin.Context) (storage.TxFilter, error) {
+	f := storage.TxFilter{
+		Status:   c.Query("status"),
+		Currency: strings.ToUpper(c.Query("currency")),
+		Category: c.Query("category"),
+		Sort:     storage.TxSort(c.Query("sort")),
+		Cursor:   c.Query("cursor"),
+		Limit:    defaultPageSize,
+	}
+	if f.Status != "" {
+		if _, err := txworker.ParseStatus(f.Status); err != nil {
+			return f, err
+		}
+	}
+	for name, dst := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s (RFC3339 expected)", name)
+			}
+			*dst = t
+		}
+	}
+	for name, dst := range map[string]**money.Money{"min_amount": &f.MinAmount, "max_amount": &f.MaxAmount} {
+		if v := c.Query(name); v != "" {
+			if f.Currency == "" {
+				return f, fmt.Errorf("%s requires currency", name)
+			}
+			m, err := money.Parse(v, f.Currency)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*dst = &m
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return f, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		f.Limit = n
+	}
+	return f, nil
+}
+
+// scopedUser resolves whose data a request reads: the caller by default.
+// Tokens and API keys with the admin:read scope may pass ?user_id= to pick
+// another user, or ?all=true for every user, reported as a nil id. The
+// scope is checked, not the role, so a narrowed admin key stays narrow.
+func scopedUser(c *gin.Context) (*uuid.UUID, bool) {
+	uid, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+	other, all := c.Query("user_id"), c.Query("all") == "true"
+	if (other != "" || all) && !auth.HasScope(c, auth.ScopeAdminRead) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "required": auth.ScopeAdminRead})
+		return nil, false
+	}
+	switch {
+	case all:
+		return nil, true
+	case other != "":
+		id, err := uuid.Parse(other)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return nil, false
+		}
+		return &id, true
+	}
+	return &uid, true
+}
+
+// listScoped lists one page of the transactions scopedUser selects.
+func (h *Handlers) listScoped(c *gin.Context, f storage.TxFilter) (storage.TxPage, bool) {
+	uid, ok := scopedUser(c)
+	if !ok {
+		return storage.TxPage{}, false
+	}
+	var (
+		page storage.TxPage
+		err  error
+	)
+	if uid == nil {
+		page, err = h.TxRepo.ListAllTx(c.Request.Context(), f)
+	} else {
+		page, err = h.TxRepo.ListTxByUser(c.Request.Context(), *uid, f)
+	}
+	switch {
+	case errors.Is(err, storage.ErrInvalidCursor), errors.Is(err, storage.ErrInvalidSort):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return storage.TxPage{}, false
+	case err != nil:
+		h.Log.Error("list transactions failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list"})
+		return storage.TxPage{}, false
+	}
+	return page, true
+}
+
 // ListTransactions godoc
 // @Summary      List transactions
-// @Description  Lists transactions for the authenticated user.
+// @Description  Lists transactions for the authenticated user, one page at a time (keyset pagination).
 // @Tags         transactions
 // @Security     BearerAuth
 // @Produce      json
 // @Param        Authorization header string true "Bearer <access token>"
-// @Success      200      {array}   storage.Transaction
+// @Param        from        query     string  false  "Timestamp lower bound, inclusive (RFC3339)"
+// @Param        to          query     string  false  "Timestamp upper bound, exclusive (RFC3339)"
+// @Param        status      query     string  false  "queued | processed | failed | reversed | cancelled"
+// @Param        currency    query     string  false  "ISO-4217 code"
+// @Param        category    query     string  false  "Category"
+// @Param        min_amount  query     string  false  "Minimum amount, inclusive (requires currency)"
+// @Param        max_amount  query     string  false  "Maximum amount, inclusive (requires currency)"
+// @Param        sort        query     string  false  "-timestamp (newest first, default) | timestamp"
+// @Param        limit       query     int     false  "Page size (1-200, default 50)"
+// @Param        cursor      query     string  false  "next_cursor of the previous page"
+// @Param        user_id     query     string  false  "Another user's id (needs admin:read)"
+// @Param        all         query     bool    false  "List every user (needs admin:read)"
+// @Success      200      {object}  TransactionPage
+// @Failure      400      {object}  map[string]string
 // @Failure      401      {object}  map[string]string
+// @Failure      403      {object}  map[string]string
 // @Router       /transactions [get]
 func (h *Handlers) ListTransactions(c *gin.Context) {
-	txs, err := h.TxRepo.ListTx()
+	f, err := parseTxFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	out := make([]Transaction, 0, len(txs))
-	for _, t := range txs {
-		out = append(out, Transaction{
-			TransactionID: t.TransactionID.String(),
-			UserID:        t.UserID.String(),
-			Amount:        t.Amount,
-			Timestamp:     t.Timestamp,
-			Status:        t.Status,
-		})
-	}
-	c.JSON(http.StatusOK, out)
-}
-
-// Reports godoc
-// @Summary      Summary reports
-// @Description  Aggregations for the authenticated user.
-// @Tags         reports
-// @Security     BearerAuth
-// @Produce      json
-// @Param        Authorization header string true "Bearer <access token>"
-// @Success      200      {object}  map[string]any
-// @Failure      401      {object}  map[string]string
-// @Router       /reports [get]
-func (h *Handlers) Reports(c *gin.Context) {
-	// agregação simples: soma por usuário (apenas processed)
-	txs, err := h.TxRepo.ListTx()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list"})
+	page, ok := h.listScoped(c, f)
+	if !ok {
 		return
 	}
-	agg := map[string]float64{}
-	for _, t := range txs {
-		if t.Status == "processed" {
-			agg[t.UserID.String()] += t.Amount
-		}
+	out := TransactionPage{Items: make([]Transaction, 0, len(page.Items)), NextCursor: page.NextCursor}
+	for _, t := range page.Items {
+		out.Items = append(out.Items, toTransactionView(t))
 	}
-	c.JSON(http.StatusOK, gin.H{"sum_by_user": agg})
+	c.JSON(http.StatusOK, out)
 }
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// microsecondStore stores timestamps the way Postgres does, truncated to
+// the microsecond.
+type microsecondStore struct {
+	*storage.MemoryStore
+}
+
+func (s microsecondStore) InsertTx(ctx context.Context, t storage.Transaction) error {
+	t.Timestamp = t.Timestamp.Truncate(time.Microsecond)
+	return s.MemoryStore.InsertTx(ctx, t)
+}
+
+func newTxHandlers() *Handlers {
+	v := validator.New()
+	_ = v.RegisterValidation("uuid4", func(fl validator.FieldLevel) bool {
+		id, err := uuid.Parse(fl.Field().String())
+		return err == nil && id.Version() == 4
+	})
+	_ = v.RegisterValidation("amount", func(fl validator.FieldLevel) bool { return fl.Field().String() != "" })
+	return &Handlers{
+		Log:     zap.NewNop(),
+		TxRepo:  microsecondStore{storage.NewMemoryStore()},
+		V:       v,
+		Enqueue: func(storage.Transaction) {},
+	}
+}
+
+func postTransaction(h *Handlers, userID uuid.UUID, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/transactions", func(c *gin.Context) { c.Set("user_id", userID.String()) }, h.CreateTransaction)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateTransactionRetry(t *testing.T) {
+	h := newTxHandlers()
+	owner, other := uuid.New(), uuid.New()
+	id := uuid.NewString()
+	body := func(amount string) string {
+		return `{"transaction_id":"` + id + `","amount":"` + amount +
+			`","currency":"BRL","timestamp":"2024-05-01T12:00:00.123456789Z","category":"food"}`
+	}
+
+	if w := postTransaction(h, owner, body("10.00")); w.Code != http.StatusAccepted {
+		t.Fatalf("first create: got %d %s, want 202", w.Code, w.Body)
+	}
+	// the stored timestamp lost its nanoseconds; the retry is still identical
+	if w := postTransaction(h, owner, body("10.00")); w.Code != http.StatusAccepted {
+		t.Errorf("identical retry: got %d %s, want 202", w.Code, w.Body)
+	}
+	if w := postTransaction(h, owner, body("11.00")); w.Code != http.StatusConflict {
+		t.Errorf("retry with another amount: got %d %s, want 409", w.Code, w.Body)
+	}
+
+	// another user's id is a plain conflict that does not say whose it is
+	w := postTransaction(h, other, body("10.00"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("same id, other user: got %d %s, want 409", w.Code, w.Body)
+	}
+	if mine := postTransaction(h, owner, body("11.00")); w.Body.String() != mine.Body.String() {
+		t.Errorf("same id, other user: got body %s, want the plain conflict %s", w.Body, mine.Body)
+	}
+}
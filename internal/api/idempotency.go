@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const maxIdempotencyKeyLen = 255
+
+// captureWriter keeps a copy of the response body so it can be stored.
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// requestFingerprint hashes method, route and body. JSON bodies are
+// canonicalized first so key order and whitespace do not matter.
+func requestFingerprint(method, route string, body []byte) string {
+	var v any
+	if json.Unmarshal(body, &v) == nil {
+		if b, err := json.Marshal(v); err == nil {
+			body = b
+		}
+	}
+	h := sha256.New()
+	h.Write([]byte(method + " " + route + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Idempotent implements Idempotency-Key semantics for the wrapped route:
+// the first response for a (user, key) is stored and replayed on retries
+// with the same payload; a different payload is rejected with 422 and a
+// retry racing the first request gets 409. Requests without the header
+// pass through untouched. Must run after RequireAuth.
+func (h *Handlers) Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+		if key == "" || h.IdemKeys == nil {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key too long"})
+			return
+		}
+		uid, ok := authUserID(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing auth context"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		fp := requestFingerprint(c.Request.Method, c.FullPath(), body)
+		stored, err := h.IdemKeys.BeginIdempotency(ctx, uid, key, fp)
+		switch {
+		case errors.Is(err, storage.ErrIdempotencyMismatch):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, storage.ErrIdempotencyInProgress):
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			h.Log.Error("idempotency lookup failed", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "idempotency check failed"})
+			return
+		case stored != nil:
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(stored.StatusCode, "application/json; charset=utf-8", stored.Body)
+			c.Abort()
+			return
+		}
+
+		w := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		// server errors are not final: free the key so the client may retry
+		if w.Status() >= http.StatusInternalServerError {
+			if err := h.IdemKeys.ReleaseIdempotency(ctx, uid, key); err != nil {
+				h.Log.Error("idempotency release failed", zap.Error(err))
+			}
+			return
+		}
+		resp := storage.IdempotentResponse{StatusCode: w.Status(), Body: w.body.Bytes()}
+		if err := h.IdemKeys.CompleteIdempotency(ctx, uid, key, resp); err != nil {
+			h.Log.Error("idempotency store failed", zap.Error(err))
+		}
+	}
+}
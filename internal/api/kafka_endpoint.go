@@ -4,9 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
-	"os"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -23,9 +21,8 @@ type KafkaMessageView struct {
 }
 
 func (h *Handlers) KafkaPoll(c *gin.Context) {
-	brokers := os.Getenv("KAFKA_BROKERS")
-	topic := os.Getenv("KAFKA_TOPIC_TRANSACTIONS")
-	if brokers == "" || topic == "" {
+	topic := h.Kafka.Topic
+	if !h.Kafka.Enabled() {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kafka not configured"})
 		return
 	}
@@ -43,7 +40,7 @@ func (h *Handlers) KafkaPoll(c *gin.Context) {
 	defer cancel()
 
 	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:     strings.Split(brokers, ","),
+		Brokers:     h.Kafka.Brokers,
 		Topic:       topic,
 		Partition:   0,
 		MinBytes:    1e3,  // 1KB
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/auth"
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	challengeTTL      = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// startChallenge answers a correct password of a 2FA user with a
+// short-lived challenge token instead of a session.
+func (h *AuthHandlers) startChallenge(c *gin.Context, u *storage.UserAuth) {
+	token, hash, err := auth.NewOpaqueToken()
+	if err == nil {
+		err = h.MFA.CreateChallenge(c.Request.Context(), hash, u.ID, time.Now().Add(challengeTTL))
+	}
+	if err != nil {
+		h.Log.Error("login challenge failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"mfa_required":    true,
+		"challenge_token": token,
+		"expires_in":      int(challengeTTL.Seconds()),
+	})
+}
+
+// verifySecondFactor checks a TOTP code (never accepting the same time step
+// twice) or spends a recovery code.
+func (h *AuthHandlers) verifySecondFactor(ctx context.Context, userID uuid.UUID, req TOTPCodeRequest) (bool, error) {
+	if req.RecoveryCode != "" {
+		return h.MFA.UseRecoveryCode(ctx, userID, auth.HashRecoveryCode(req.RecoveryCode))
+	}
+	st, err := h.MFA.TOTP(ctx, userID)
+	if err != nil || !st.Enabled {
+		return false, err
+	}
+	step, ok := auth.VerifyTOTP(st.Secret, req.Code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return h.MFA.UseTOTPStep(ctx, userID, step)
+}
+
+// bindCode reads a TOTPCodeRequest that must carry a code or a recovery code.
+func (h *AuthHandlers) bindCode(c *gin.Context, req *TOTPCodeRequest, allowRecovery bool) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return false
+	}
+	if err := h.V.Struct(req); err != nil || (req.Code == "" && (!allowRecovery || req.RecoveryCode == "")) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "a 6-digit code is required"})
+		return false
+	}
+	return true
+}
+
+// LoginTOTP godoc
+// @Summary      Second login step (2FA)
+// @Description  Exchanges the challenge token returned by /auth/login plus a TOTP or recovery code for the access and refresh tokens.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      LoginTOTPRequest  true  "Challenge and code"
+// @Success      200      {object}  map[string]any
+// @Failure      401      {object}  map[string]string
+// @Failure      429      {object}  map[string]string
+// @Router       /auth/login/2fa [post]
+func (h *AuthHandlers) LoginTOTP(c *gin.Context) {
+	var req LoginTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if err := h.V.Struct(req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "challenge_token and code (or recovery_code) are required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	hash := auth.HashOpaqueToken(req.ChallengeToken)
+	userID, err := h.MFA.AttemptChallenge(ctx, hash)
+	if err != nil {
+		if !errors.Is(err, storage.ErrChallengeInvalid) {
+			h.Log.Error("login challenge lookup failed", zap.Error(err))
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+		return
+	}
+	u, err := h.UsersDB.GetUserAuthByID(ctx, userID)
+	if err != nil || u.Deactivated {
+		if err != nil {
+			h.Log.Error("login challenge user lookup failed", zap.Error(err))
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+		return
+	}
+
+	// wrong codes count as failed logins of the account
+	ip := c.ClientIP()
+	if !h.checkThrottle(c, u.Email, ip) {
+		return
+	}
+	ok, err := h.verifySecondFactor(ctx, userID, req.TOTPCodeRequest)
+	if err != nil {
+		h.Log.Error("2fa verification failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	if !ok {
+		if h.Guard != nil {
+			if gerr := h.Guard.Failure(ctx, u.Email, ip); gerr != nil {
+				h.Log.Error("login failure tracking failed", zap.Error(gerr))
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	if err := h.MFA.ConsumeChallenge(ctx, hash); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+		return
+	}
+	h.startSession(c, u)
+}
+
+// EnrollTOTP godoc
+// @Summary      Start 2FA enrollment
+// @Description  Generates a TOTP secret and its provisioning URI. 2FA is enabled once a first code is verified.
+// @Tags         auth
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Success      200      {object}  map[string]string
+// @Failure      409      {object}  map[string]string
+// @Router       /auth/2fa/enroll [post]
+func (h *AuthHandlers) EnrollTOTP(c *gin.Context) {
+	uid, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	ctx := c.Request.Context()
+	u, err := h.UsersDB.GetUserAuthByID(ctx, uid)
+	if err != nil {
+		h.Log.Error("2fa enroll user lookup failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "enrollment failed"})
+		return
+	}
+	secret, err := auth.NewTOTPSecret()
+	if err == nil {
+		err = h.MFA.SetPendingTOTP(ctx, uid, secret)
+	}
+	switch {
+	case errors.Is(err, storage.ErrTOTPAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.Log.Error("2fa enroll failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "enrollment failed"})
+		return
+	}
+
+	issuer := h.TOTPIssuer
+	if issuer == "" {
+		issuer = "finance-api"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(issuer, u.Email, secret),
+	})
+}
+
+// VerifyTOTP godoc
+// @Summary      Finish 2FA enrollment
+// @Description  Verifies the first code from the authenticator app, enables 2FA and returns the recovery codes (shown only once). Every other session is logged out; the response carries new tokens for this one.
+// @Tags         auth
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        payload  body      TOTPCodeRequest  true  "First code"
+// @Success      200      {object}  map[string]any
+// @Failure      401      {object}  map[string]string
+// @Failure      409      {object}  map[string]string
+// @Router       /auth/2fa/verify [post]
+func (h *AuthHandlers) VerifyTOTP(c *gin.Context) {
+	uid, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var req TOTPCodeRequest
+	if !h.bindCode(c, &req, false) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	st, err := h.MFA.TOTP(ctx, uid)
+	if err != nil {
+		h.Log.Error("2fa state lookup failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return
+	}
+	switch {
+	case st.Enabled:
+		c.JSON(http.StatusConflict, gin.H{"error": storage.ErrTOTPAlreadyEnabled.Error()})
+		return
+	case st.Secret == "":
+		c.JSON(http.StatusConflict, gin.H{"error": storage.ErrTOTPNotEnrolled.Error()})
+		return
+	}
+	step, ok := auth.VerifyTOTP(st.Secret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+
+	// a session stolen before 2FA was on must not outlive it: end them all
+	// first, as a password change does; this one gets fresh tokens below
+	err = h.Sessions.RevokeUserRefreshTokens(ctx, uid)
+	if err == nil {
+		err = h.Sessions.RevokeUserAccessTokens(ctx, uid)
+	}
+	if err != nil {
+		h.Log.Error("session revocation before 2fa enable failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err == nil {
+		err = h.MFA.EnableTOTP(ctx, uid, step, hashes)
+	}
+	switch {
+	case errors.Is(err, storage.ErrTOTPAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.Log.Error("2fa enable failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return
+	}
+
+	// the recovery codes are shown only now, so they are returned even if
+	// the new session cannot be started (the client then logs in again)
+	var body gin.H
+	u, err := h.UsersDB.GetUserAuthByID(ctx, uid)
+	if err == nil {
+		body, err = h.newSession(ctx, u)
+	}
+	if err != nil {
+		h.Log.Error("session after 2fa enable failed", zap.Error(err))
+		body = gin.H{}
+	}
+	body["enabled"] = true
+	body["recovery_codes"] = codes
+	c.JSON(http.StatusOK, body)
+}
+
+// DisableTOTP godoc
+// @Summary      Disable 2FA
+// @Description  Turns 2FA off; requires a current TOTP or recovery code.
+// @Tags         auth
+// @Security     BearerAuth
+// @Accept       json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        payload  body      TOTPCodeRequest  true  "Code"
+// @Success      204
+// @Failure      401      {object}  map[string]string
+// @Router       /auth/2fa/disable [post]
+func (h *AuthHandlers) DisableTOTP(c *gin.Context) {
+	uid, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var req TOTPCodeRequest
+	if !h.bindCode(c, &req, true) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	ok, err := h.verifySecondFactor(ctx, uid, req)
+	if err == nil && ok {
+		err = h.MFA.DisableTOTP(ctx, uid)
+	}
+	switch {
+	case err != nil:
+		h.Log.Error("2fa disable failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "disable failed"})
+	case !ok:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/storage"
+	txworker "github.com/AgentTarik/finance-api/internal/transaction"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func toReportRows(rows []storage.ReportRow) []ReportRowView {
+	out := make([]ReportRowView, 0, len(rows))
+	for _, r := range rows {
+		v := ReportRowView{
+			Group:    r.Group,
+			Currency: r.Currency,
+			Count:    r.Count,
+			Total:    r.Total.String(),
+			Min:      r.Min.String(),
+			Max:      r.Max.String(),
+			Avg:      r.Avg,
+		}
+		if !r.Bucket.IsZero() {
+			b := r.Bucket
+			v.BucketStart = &b
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// parseReportQuery reads the report filters. Status defaults to processed;
+// status=all aggregates every status.
+func parseReportQuery(c *gin.Context) (storage.ReportQuery, error) {
+	q := storage.ReportQuery{
+		Status:   c.DefaultQuery("status", string(txworker.Processed)),
+		Currency: strings.ToUpper(c.Query("currency")),
+		Location: time.UTC,
+	}
+	if q.Status == "all" {
+		q.Status = ""
+	} else if _, err := txworker.ParseStatus(q.Status); err != nil {
+		return q, err
+	}
+	if tz := c.Query("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return q, errors.New("invalid tz (IANA name expected)")
+		}
+		q.Location = loc
+	}
+	// dates without a time are midnight in the report's time zone
+	for name, dst := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.ParseInLocation(time.DateOnly, v, q.Location); err != nil {
+				return q, errors.New("invalid " + name + " (RFC3339 or YYYY-MM-DD expected)")
+			}
+		}
+		*dst = t
+	}
+	return q, nil
+}
+
+// Reports godoc
+// @Summary      Summary reports
+// @Description  Aggregations for the authenticated user, computed in the database: per-currency totals, count, min/max/avg, optional day/week/month buckets and breakdowns.
+// @Tags         reports
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer <access token>"
+// @Param        from      query     string  false  "Lower bound, inclusive (RFC3339 or YYYY-MM-DD)"
+// @Param        to        query     string  false  "Upper bound, exclusive (RFC3339 or YYYY-MM-DD)"
+// @Param        tz        query     string  false  "IANA time zone for dates and buckets (default UTC)"
+// @Param        status    query     string  false  "Status to aggregate (default processed; all for every status)"
+// @Param        currency  query     string  false  "ISO-4217 code"
+// @Param        bucket    query     string  false  "day | week | month"
+// @Param        group_by  query     string  false  "Comma-separated breakdowns: status, category, user"
+// @Param        user_id   query     string  false  "Another user's id (needs admin:read)"
+// @Param        all       query     bool    false  "Aggregate every user (needs admin:read)"
+// @Success      200      {object}  ReportResponse
+// @Failure      400      {object}  map[string]string
+// @Failure      401      {object}  map[string]string
+// @Failure      403      {object}  map[string]string
+// @Router       /reports [get]
+func (h *Handlers) Reports(c *gin.Context) {
+	q, err := parseReportQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	bucket := storage.ReportBucket(c.Query("bucket"))
+	switch bucket {
+	case "", storage.BucketDay, storage.BucketWeek, storage.BucketMonth:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bucket must be day, week or month"})
+		return
+	}
+	var dims []storage.ReportDimension
+	if v := c.Query("group_by"); v != "" {
+		for _, d := range strings.Split(v, ",") {
+			switch d := storage.ReportDimension(strings.TrimSpace(d)); d {
+			case storage.ByStatus, storage.ByCategory, storage.ByUser:
+				dims = append(dims, d)
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "group_by accepts status, category and user"})
+				return
+			}
+		}
+	}
+	uid, ok := scopedUser(c)
+	if !ok {
+		return
+	}
+	q.UserID = uid
+
+	ctx := c.Request.Context()
+	resp := ReportResponse{
+		Timezone: q.Location.String(),
+		Status:   q.Status,
+		Bucket:   string(bucket),
+	}
+	if uid != nil {
+		resp.UserID = uid.String()
+	}
+	if !q.From.IsZero() {
+		resp.From = &q.From
+	}
+	if !q.To.IsZero() {
+		resp.To = &q.To
+	}
+
+	fail := func(err error) {
+		h.Log.Error("report failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to aggregate"})
+	}
+	totals, err := h.Reporting.ReportTotals(ctx, q)
+	if err != nil {
+		fail(err)
+		return
+	}
+	resp.Totals = toReportRows(totals)
+	if bucket != "" {
+		rows, err := h.Reporting.ReportBuckets(ctx, q, bucket)
+		if err != nil {
+			fail(err)
+			return
+		}
+		resp.Buckets = toReportRows(rows)
+	}
+	if len(dims) > 0 {
+		resp.Breakdowns = make(map[string][]ReportRowView, len(dims))
+		for _, d := range dims {
+			rows, err := h.Reporting.ReportBreakdown(ctx, q, d)
+			if err != nil {
+				fail(err)
+				return
+			}
+			resp.Breakdowns[string(d)] = toReportRows(rows)
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -6,26 +6,80 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// SetupRoutes registers every route with the permission it requires:
+// public routes need none, the rest need a valid token (or API key) plus
+// the scope given next to them. Session routes are deliberately exempt from
+// scopes: they manage the caller's own account and credentials, so they
+// take a user's access token and never an API key, whatever its scopes.
 func SetupRoutes(r *gin.Engine, h *Handlers) {
+	requireAuth := auth.RequireAuth(h.Auth.JWT, h.Auth.Keys, h.Auth.Sessions, h.Auth.APIKeys)
+	scope := auth.RequireScope
+
 	v1 := r.Group("/v1")
 	{
+		// public
 		v1.POST("/auth/register", h.Auth.Register)
 		v1.POST("/auth/login", h.Auth.Login)
-		v1.GET("/users/:id", h.GetUser)
+		v1.POST("/auth/login/2fa", h.Auth.LoginTOTP)
+		v1.POST("/auth/refresh", h.Auth.Refresh)
+		v1.GET("/auth/verify-email", h.Auth.VerifyEmail) // mailed link
+		v1.POST("/auth/verify-email", h.Auth.VerifyEmail)
+		v1.POST("/auth/password-reset/request", h.Auth.RequestPasswordReset)
+		v1.POST("/auth/password-reset/confirm", h.Auth.ResetPassword)
+		v1.GET("/health", h.Health)
 
 		protected := v1.Group("/")
-		protected.Use(auth.RequireAuth())
+		protected.Use(requireAuth)
 
-		protected.POST("/transactions", h.CreateTransaction)
-		protected.GET("/transactions", h.ListTransactions)
+		// any access token, but no API key: account management (no scope,
+		// see above)
+		session := protected.Group("/")
+		session.Use(auth.RequireSession())
 
-		protected.GET("/reports", h.Reports)
-		
-		v1.GET("/kafka/poll", h.KafkaPoll)
+		session.POST("/auth/logout", h.Auth.Logout)
+		session.POST("/auth/2fa/enroll", h.Auth.EnrollTOTP)
+		session.POST("/auth/2fa/verify", h.Auth.VerifyTOTP)
+		session.POST("/auth/2fa/disable", h.Auth.DisableTOTP)
+		session.POST("/auth/verify-email/request", h.Auth.RequestEmailVerification)
 
-		v1.GET("/health", h.Health)
-	}
+		session.PATCH("/me", h.UpdateMe)
+		session.POST("/me/password", h.Auth.ChangePassword)
+		session.DELETE("/me", h.Auth.DeactivateAccount)
+
+		session.POST("/api-keys", h.Auth.CreateAPIKey)
+		session.GET("/api-keys", h.Auth.ListAPIKeys)
+		session.GET("/api-keys/:id", h.Auth.GetAPIKey)
+		session.PATCH("/api-keys/:id", h.Auth.UpdateAPIKey)
+		session.DELETE("/api-keys/:id", h.Auth.RevokeAPIKey)
+
+		protected.GET("/me", scope(auth.ScopeUsersRead), h.GetMe)
+		protected.GET("/users/:id", scope(auth.ScopeUsersRead), h.GetUser)
+
+		protected.POST("/transactions", scope(auth.ScopeTransactionsWrite), h.Auth.RequireVerifiedEmail(), h.Idempotent(), h.CreateTransaction)
+		protected.GET("/transactions", scope(auth.ScopeTransactionsRead), h.ListTransactions)
+		protected.GET("/transactions/:id", scope(auth.ScopeTransactionsRead), h.GetTransaction)
+		protected.POST("/transactions/:id/cancel", scope(auth.ScopeTransactionsWrite), h.CancelTransaction)
 
+		protected.GET("/reports", scope(auth.ScopeReportsRead), h.Reports)
+
+		protected.GET("/accounts/:id/balance", scope(auth.ScopeBalancesRead), h.GetBalance)
+
+		protected.GET("/kafka/poll", scope(auth.ScopeEventsRead), h.KafkaPoll)
+
+		admin := v1.Group("/admin")
+		admin.Use(requireAuth)
+
+		admin.GET("/dlq", scope(auth.ScopeDeadLetters), h.ListDeadLetters)
+		admin.GET("/dlq/:id", scope(auth.ScopeDeadLetters), h.GetDeadLetter)
+		admin.POST("/dlq/:id/replay", scope(auth.ScopeDeadLetters), h.ReplayDeadLetter)
+		admin.POST("/dlq/:id/discard", scope(auth.ScopeDeadLetters), h.DiscardDeadLetter)
+
+		admin.POST("/transactions/:id/retry", scope(auth.ScopeTransactionsAdmin), h.RetryTransaction)
+		admin.POST("/transactions/:id/reverse", scope(auth.ScopeTransactionsAdmin), h.ReverseTransaction)
+
+		admin.POST("/login-locks/unlock", scope(auth.ScopeUsersAdmin), h.Auth.UnlockLogin)
+	}
 
+	r.GET("/.well-known/jwks.json", h.Auth.JWKS)
 	r.GET("/metrics", telemetry.MetricsHandler())
 }
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/ledger"
+	"github.com/AgentTarik/finance-api/internal/storage"
+	txworker "github.com/AgentTarik/finance-api/internal/transaction"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func toTransactionView(t storage.Transaction) Transaction {
+	return Transaction{
+		TransactionID: t.TransactionID.String(),
+		UserID:        t.UserID.String(),
+		Amount:        t.Amount.String(),
+		Currency:      t.Amount.Currency(),
+		Timestamp:     t.Timestamp,
+		Category:      t.Category,
+		Status:        t.Status,
+		CreatedAt:     t.CreatedAt,
+		UpdatedAt:     t.UpdatedAt,
+		ProcessedAt:   t.ProcessedAt,
+		LastError:     t.LastError,
+	}
+}
+
+const (
+	maxLongPollWait  = 30 * time.Second
+	longPollInterval = 250 * time.Millisecond
+)
+
+// loadTransaction resolves :id to a transaction. Unless anyUser is set the
+// lookup is scoped to the caller, so other users' transactions are reported
+// as missing and their existence does not leak.
+func (h *Handlers) loadTransaction(c *gin.Context, anyUser bool) (storage.Transaction, bool) {
+	authID, ok := authUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing auth context"})
+		return storage.Transaction{}, false
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return storage.Transaction{}, false
+	}
+	var t storage.Transaction
+	if anyUser {
+		t, err = h.TxRepo.GetTx(c.Request.Context(), id)
+	} else {
+		t, err = h.TxRepo.GetTxForUser(c.Request.Context(), authID, id)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrTxNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "transaction not found"})
+		} else {
+			h.Log.Error("transaction lookup failed", zap.Error(err), zap.String("tx_id", id.String()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load transaction"})
+		}
+		return storage.Transaction{}, false
+	}
+	return t, true
+}
+
+// changeStatus validates and persists a transition without ledger effects.
+// It writes the response and reports whether the change was applied.
+func (h *Handlers) changeStatus(c *gin.Context, t storage.Transaction, to txworker.Status, reason string) bool {
+	from, err := txworker.ParseStatus(t.Status)
+	if err == nil {
+		var ch storage.StatusChange
+		if ch, err = txworker.Change(t.TransactionID, from, to, reason); err == nil {
+			err = h.Statuses.ChangeStatus(c.Request.Context(), ch)
+		}
+	}
+	return h.statusChanged(c, t, to, err)
+}
+
+func (h *Handlers) statusChanged(c *gin.Context, t storage.Transaction, to txworker.Status, err error) bool {
+	switch {
+	case errors.Is(err, txworker.ErrIllegalTransition), errors.Is(err, storage.ErrStatusConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "cannot move transaction from " + t.Status + " to " + string(to)})
+		return false
+	case err != nil:
+		h.Log.Error("status change failed", zap.Error(err), zap.String("tx_id", t.TransactionID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "status change failed"})
+		return false
+	default:
+		h.Log.Info("transaction status changed",
+			zap.String("tx_id", t.TransactionID.String()),
+			zap.String("from", t.Status),
+			zap.String("to", string(to)),
+			zap.String("by", c.GetString("user_id")))
+		c.JSON(http.StatusOK, gin.H{"transaction_id": t.TransactionID.String(), "status": string(to)})
+		return true
+	}
+}
+
+func (h *Handlers) bindReason(c *gin.Context) (string, bool) {
+	var req StatusChangeRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
+			return "", false
+		}
+		if err := h.V.Struct(req); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return "", false
+		}
+	}
+	return req.Reason, true
+}
+
+// GetTransaction godoc
+// @Summary      Get a transaction
+// @Description  Status, timestamps, last processing error and status history of one of the
+// @Description  authenticated user's transactions. With wait, the call long-polls until the
+// @Description  status differs from status (default: the current one) or the wait elapses.
+// @Tags         transactions
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Authorization header string true  "Bearer <access token>"
+// @Param        id            path   string true  "Transaction id"
+// @Param        wait          query  string false "Long-poll duration, e.g. 20s (max 30s)"
+// @Param        status        query  string false "Status the client already knows"
+// @Success      200      {object}  TransactionDetail
+// @Failure      400      {object}  map[string]string
+// @Failure      401      {object}  map[string]string
+// @Failure      404      {object}  map[string]string
+// @Router       /transactions/{id} [get]
+func (h *Handlers) GetTransaction(c *gin.Context) {
+	var wait time.Duration
+	if raw := c.Query("wait"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wait (duration expected, e.g. 20s)"})
+			return
+		}
+		wait = min(d, maxLongPollWait)
+	}
+
+	t, ok := h.loadTransaction(c, false)
+	if !ok {
+		return
+	}
+	if wait > 0 {
+		known := c.DefaultQuery("status", t.Status)
+		if t, ok = h.awaitStatusChange(c, t, known, wait); !ok {
+			return
+		}
+	}
+
+	history, err := h.Statuses.StatusHistory(c.Request.Context(), t.TransactionID)
+	if err != nil {
+		h.Log.Error("status history failed", zap.Error(err), zap.String("tx_id", t.TransactionID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load transaction"})
+		return
+	}
+	out := TransactionDetail{Transaction: toTransactionView(t), History: make([]StatusChangeView, 0, len(history))}
+	for _, ch := range history {
+		out.History = append(out.History, StatusChangeView{From: ch.From, To: ch.To, Reason: ch.Reason, At: ch.At})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// awaitStatusChange polls until t's status differs from known, the wait
+// elapses or the client goes away, and returns the latest state.
+func (h *Handlers) awaitStatusChange(c *gin.Context, t storage.Transaction, known string, wait time.Duration) (storage.Transaction, bool) {
+	ctx := c.Request.Context()
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	tick := time.NewTicker(longPollInterval)
+	defer tick.Stop()
+
+	for t.Status == known {
+		select {
+		case <-ctx.Done():
+			return t, false
+		case <-deadline.C:
+			return t, true
+		case <-tick.C:
+		}
+		cur, err := h.TxRepo.GetTxForUser(ctx, t.UserID, t.TransactionID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return t, false
+			}
+			h.Log.Error("transaction poll failed", zap.Error(err), zap.String("tx_id", t.TransactionID.String()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load transaction"})
+			return t, false
+		}
+		t = cur
+	}
+	return t, true
+}
+
+// CancelTransaction godoc
+// @Summary      Cancel a transaction
+// @Description  Withdraws a transaction that is still queued.
+// @Tags         transactions
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true  "Bearer <access token>"
+// @Param        id            path   string true  "Transaction id"
+// @Param        payload       body   StatusChangeRequest false "Reason"
+// @Success      200      {object}  map[string]string
+// @Failure      404      {object}  map[string]string
+// @Failure      409      {object}  map[string]string
+// @Router       /transactions/{id}/cancel [post]
+func (h *Handlers) CancelTransaction(c *gin.Context) {
+	reason, ok := h.bindReason(c)
+	if !ok {
+		return
+	}
+	t, ok := h.loadTransaction(c, false)
+	if !ok {
+		return
+	}
+	if reason == "" {
+		reason = "cancelled by user"
+	}
+	_ = h.changeStatus(c, t, txworker.Cancelled, reason)
+}
+
+// RetryTransaction godoc
+// @Summary      Retry a failed transaction
+// @Description  Puts a failed transaction back into the queue (admin only).
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true  "Bearer <access token>"
+// @Param        id            path   string true  "Transaction id"
+// @Param        payload       body   StatusChangeRequest false "Reason"
+// @Success      200      {object}  map[string]string
+// @Failure      404      {object}  map[string]string
+// @Failure      409      {object}  map[string]string
+// @Router       /admin/transactions/{id}/retry [post]
+func (h *Handlers) RetryTransaction(c *gin.Context) {
+	reason, ok := h.bindReason(c)
+	if !ok {
+		return
+	}
+	t, ok := h.loadTransaction(c, true)
+	if !ok {
+		return
+	}
+	if reason == "" {
+		reason = "manual retry"
+	}
+	if h.changeStatus(c, t, txworker.Queued, reason) {
+		h.Enqueue(t)
+	}
+}
+
+// ReverseTransaction godoc
+// @Summary      Reverse a processed transaction
+// @Description  Posts a reversing ledger entry and marks the transaction reversed (admin only).
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true  "Bearer <access token>"
+// @Param        id            path   string true  "Transaction id"
+// @Param        payload       body   StatusChangeRequest false "Reason"
+// @Success      200      {object}  map[string]string
+// @Failure      404      {object}  map[string]string
+// @Failure      409      {object}  map[string]string
+// @Router       /admin/transactions/{id}/reverse [post]
+func (h *Handlers) ReverseTransaction(c *gin.Context) {
+	reason, ok := h.bindReason(c)
+	if !ok {
+		return
+	}
+	t, ok := h.loadTransaction(c, true)
+	if !ok {
+		return
+	}
+	if reason == "" {
+		reason = "reversed by admin"
+	}
+	ch, err := txworker.Change(t.TransactionID, txworker.Status(t.Status), txworker.Reversed, reason)
+	if err == nil {
+		var entry ledger.Entry
+		if entry, err = ledger.ReversalEntry(t.TransactionID, t.UserID, t.Amount, time.Now().UTC()); err == nil {
+			err = h.Ledger.PostTx(c.Request.Context(), ch, entry, nil, nil)
+		}
+	}
+	_ = h.statusChanged(c, t, txworker.Reversed, err)
+}
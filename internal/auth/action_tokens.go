@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Purposes of action tokens; a token only works for the purpose it was
+// issued for.
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+var ErrActionTokenInvalid = errors.New("token invalid or expired")
+
+// actionClaims are the claims of an action token. They carry no role or
+// scopes and are signed with their own key, so an action token is never
+// accepted as an access token.
+type actionClaims struct {
+	jwt.RegisteredClaims
+	Purpose string `json:"purpose"`
+	Email   string `json:"email"` // the address the token was mailed to
+}
+
+// ActionTokens signs the links mailed to users (email verification,
+// password reset). Tokens are HS256 JWTs that expire; single use is
+// enforced by storing their jti (see storage.AccountRepo).
+type ActionTokens struct {
+	secret []byte
+}
+
+// NewActionTokens signs with secret; an empty secret picks a random one,
+// which invalidates outstanding links on every restart.
+func NewActionTokens(secret []byte) (*ActionTokens, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return &ActionTokens{secret: secret}, nil
+}
+
+// NewActionTokensFromConfig signs with acct.ActionTokenSecret or, when
+// unset, a key derived from jwtCfg.Secret (never the JWT secret itself, so
+// action tokens cannot pass as access tokens). It fails when neither is set.
+func NewActionTokensFromConfig(acct config.Account, jwtCfg config.JWT) (*ActionTokens, error) {
+	if s := acct.ActionTokenSecret; s != "" {
+		return NewActionTokens([]byte(s))
+	}
+	if s := jwtCfg.Secret; s != "" {
+		mac := hmac.New(sha256.New, []byte(s))
+		mac.Write([]byte("finance-api action tokens"))
+		return NewActionTokens(mac.Sum(nil))
+	}
+	return nil, errors.New("account.action_token_secret (ACTION_TOKEN_SECRET) or jwt.secret (JWT_SECRET) is required")
+}
+
+// Issue signs a token for purpose that lets userID act until now+ttl, as
+// long as their email is still email. The returned id (jti) is what gets
+// stored to spend the token once.
+func (a *ActionTokens) Issue(purpose string, userID uuid.UUID, email string, ttl time.Duration) (token, id string, exp time.Time, err error) {
+	now := time.Now()
+	exp = now.Add(ttl)
+	id = uuid.NewString()
+	claims := actionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+			ID:        id,
+		},
+		Purpose: purpose,
+		Email:   email,
+	}
+	token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.secret)
+	return token, id, exp, err
+}
+
+// Parse verifies a token issued for purpose and returns its user, the email
+// it was mailed to and its id.
+func (a *ActionTokens) Parse(purpose, token string) (userID uuid.UUID, email, id string, err error) {
+	claims := &actionClaims{}
+	_, err = jwt.ParseWithClaims(token, claims,
+		func(*jwt.Token) (any, error) { return a.secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || claims.Purpose != purpose || claims.ID == "" || claims.Email == "" {
+		return uuid.Nil, "", "", ErrActionTokenInvalid
+	}
+	userID, err = uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", "", ErrActionTokenInvalid
+	}
+	return userID, claims.Email, claims.ID, nil
+}
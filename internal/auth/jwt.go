@@ -2,55 +2,70 @@ package auth
 
 import (
 	"errors"
-	"os"
+	"strings"
 	"time"
 
+	"github.com/AgentTarik/finance-api/internal/config"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Claims are the registered claims plus the user's role and scopes.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role  string `json:"role,omitempty"`
+	Scope string `json:"scope,omitempty"` // space-separated
+}
+
 type JWTIssuer struct {
-	secret   []byte
-	issuer   string
-	audience string
-	ttl      time.Duration
+	keys       *KeySet
+	issuer     string
+	audience   string
+	ttl        time.Duration
+	refreshTTL time.Duration
 }
 
-func NewJWTIssuerFromEnv() (*JWTIssuer, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return nil, errors.New("JWT_SECRET is required")
-	}
-	iss := os.Getenv("JWT_ISS")
-	if iss == "" {
-		iss = "finance-api"
-	}
-	aud := os.Getenv("JWT_AUD")
-	ttl := 15 * time.Minute
-	if v := os.Getenv("JWT_ACCESS_TTL"); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			ttl = d
-		}
+// NewJWTIssuer issues tokens signed with the signing key of keys.
+func NewJWTIssuer(keys *KeySet, cfg config.JWT) (*JWTIssuer, error) {
+	if keys == nil {
+		return nil, errors.New("signing keys are required")
 	}
 	return &JWTIssuer{
-		secret:   []byte(secret),
-		issuer:   iss,
-		audience: aud,
-		ttl:      ttl,
+		keys:       keys,
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		ttl:        cfg.AccessTTL,
+		refreshTTL: cfg.RefreshTTL,
 	}, nil
 }
 
-func (j *JWTIssuer) Issue(userID string) (string, time.Time, error) {
+// RefreshTTL is the lifetime of refresh tokens handed out with access tokens.
+func (j *JWTIssuer) RefreshTTL() time.Duration { return j.refreshTTL }
+
+func (j *JWTIssuer) Issue(userID, role string, scopes []string) (string, time.Time, error) {
 	now := time.Now()
 	exp := now.Add(j.ttl)
-	claims := jwt.RegisteredClaims{
-		Issuer:    j.issuer,
-		Subject:   userID,
-		Audience:  jwt.ClaimStrings{j.audience},
-		IssuedAt:  jwt.NewNumericDate(now),
-		NotBefore: jwt.NewNumericDate(now.Add(-30 * time.Second)), // small skew
-		ExpiresAt: jwt.NewNumericDate(exp),
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.issuer,
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{j.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now.Add(-30 * time.Second)), // small skew
+			ExpiresAt: jwt.NewNumericDate(exp),
+			ID:        uuid.NewString(), // jti, the handle for revocation
+		},
+		Role:  role,
+		Scope: strings.Join(scopes, " "),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString(j.secret)
+	key := j.keys.Signing()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.sign)
 	return signed, exp, err
 }
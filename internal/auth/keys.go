@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/AgentTarik/finance-api/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// hmacKeyID identifies the shared-secret key; tokens without a kid header
+// are verified with it too. It is never published in the JWKS.
+const hmacKeyID = "hs256"
+
+// Key is one signing or verification key.
+type Key struct {
+	ID     string // kid header
+	Method jwt.SigningMethod
+	sign   any // private key (or HMAC secret); nil for verify-only keys
+	verify any // public key (or HMAC secret)
+}
+
+// KeySet holds the key tokens are signed with and every key tokens are
+// accepted from. Keeping the previous and next keys in the verification set
+// allows rotating the signing key without downtime.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet builds a set signing with signing and verifying with signing
+// plus extra.
+func NewKeySet(signing *Key, extra ...*Key) (*KeySet, error) {
+	if signing == nil || signing.sign == nil {
+		return nil, errors.New("a signing key is required")
+	}
+	ks := &KeySet{signing: signing, keys: map[string]*Key{}}
+	for _, k := range append([]*Key{signing}, extra...) {
+		if _, dup := ks.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+	return ks, nil
+}
+
+// LoadKeySet reads the keys configured in cfg:
+//
+//	SigningKeyFile  PEM private key (RSA or Ed25519) to sign with
+//	VerifyKeyFiles  PEM keys also accepted (rotation)
+//	Secret          HS256 secret; signs when no PEM key is set and is
+//	                otherwise still accepted for verification
+func LoadKeySet(cfg config.JWT) (*KeySet, error) {
+	var (
+		signing *Key
+		extra   []*Key
+	)
+	secret := cfg.Secret
+	if path := cfg.SigningKeyFile; path != "" {
+		k, err := LoadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if k.sign == nil {
+			return nil, fmt.Errorf("%s: signing key must be a private key", path)
+		}
+		signing = k
+		if secret != "" {
+			extra = append(extra, HMACKey(secret))
+		}
+	} else if secret != "" {
+		signing = HMACKey(secret)
+	} else {
+		return nil, errors.New("jwt.signing_key_file (JWT_SIGNING_KEY_FILE) or jwt.secret (JWT_SECRET) is required")
+	}
+
+	for _, path := range cfg.VerifyKeyFiles {
+		k, err := LoadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if k.ID == signing.ID {
+			continue // the signing key is already trusted
+		}
+		extra = append(extra, k)
+	}
+	return NewKeySet(signing, extra...)
+}
+
+// HMACKey is an HS256 shared-secret key.
+func HMACKey(secret string) *Key {
+	return &Key{ID: hmacKeyID, Method: jwt.SigningMethodHS256, sign: []byte(secret), verify: []byte(secret)}
+}
+
+// LoadKeyFile reads a PEM key: a private key (PKCS#8, or PKCS#1 for RSA)
+// or a public key (PKIX). Its kid is derived from the public key, so every
+// service computes the same id for the same key.
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	k, err := ParsePEMKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
+
+// ParsePEMKey parses the key in a PEM block; see LoadKeyFile.
+func ParsePEMKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var priv, pub any
+	switch block.Type {
+	case "PRIVATE KEY":
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		priv = k
+	case "RSA PRIVATE KEY":
+		k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		priv = k
+	case "PUBLIC KEY":
+		k, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub = k
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if priv != nil {
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+		pub = signer.Public()
+	}
+
+	k := &Key{sign: priv, verify: pub}
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		if p.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		k.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	k.ID = hex.EncodeToString(sum[:8])
+	return k, nil
+}
+
+// Signing returns the key new tokens are signed with.
+func (ks *KeySet) Signing() *Key { return ks.signing }
+
+// keyFunc resolves a token's verification key by kid and rejects tokens
+// whose alg does not match that key.
+func (ks *KeySet) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		kid = hmacKeyID // tokens issued before kids were introduced
+	}
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if t.Method.Alg() != k.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return k.verify, nil
+}
+
+// methods lists the algorithms accepted by the set.
+func (ks *KeySet) methods() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, k := range ks.keys {
+		if alg := k.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			out = append(out, alg)
+		}
+	}
+	return out
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // OKP curve
+	X         string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the asymmetric verification keys. Shared secrets are
+// never included.
+func (ks *KeySet) JWKS() JWKS {
+	b64 := base64.RawURLEncoding.EncodeToString
+	out := JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+		switch p := k.verify.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = b64(p.N.Bytes())
+			jwk.E = b64(big.NewInt(int64(p.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = b64(p)
+		default:
+			continue
+		}
+		out.Keys = append(out.Keys, jwk)
+	}
+	sort.Slice(out.Keys, func(i, j int) bool { return out.Keys[i].KeyID < out.Keys[j].KeyID })
+	return out
+}
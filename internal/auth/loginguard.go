@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/config"
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/AgentTarik/finance-api/telemetry"
+)
+
+// ThrottledError rejects a login attempt made too soon after failures, or
+// while the email or IP is locked out.
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("login locked, retry in %s", e.RetryAfter)
+	}
+	return fmt.Sprintf("too many failed logins, retry in %s", e.RetryAfter)
+}
+
+// LoginPolicy is how failures of one kind (email or IP) are throttled: after
+// n failures the next attempt must wait BaseDelay*2^(n-1) (up to MaxDelay),
+// and MaxFailures failures (if positive) lock the key for LockoutFor.
+// Failures older than ResetAfter are forgotten.
+type LoginPolicy struct {
+	MaxFailures int
+	LockoutFor  time.Duration
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	ResetAfter  time.Duration
+}
+
+func (p LoginPolicy) delay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := 1; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// LoginGuard protects the login endpoint against password guessing. State is
+// kept in the database so every replica enforces the same limits.
+type LoginGuard struct {
+	repo   storage.LoginAttemptRepo
+	policy map[string]LoginPolicy // by storage.LoginByEmail / LoginByIP
+}
+
+// NewLoginGuard applies the email and IP policies of cfg.
+func NewLoginGuard(repo storage.LoginAttemptRepo, cfg config.Login) *LoginGuard {
+	return &LoginGuard{
+		repo: repo,
+		policy: map[string]LoginPolicy{
+			storage.LoginByEmail: {
+				MaxFailures: cfg.EmailMaxFailures, LockoutFor: cfg.EmailLockout,
+				BaseDelay: cfg.EmailBaseDelay, MaxDelay: cfg.EmailMaxDelay, ResetAfter: cfg.EmailResetAfter,
+			},
+			storage.LoginByIP: {
+				MaxFailures: cfg.IPMaxFailures, LockoutFor: cfg.IPLockout,
+				BaseDelay: cfg.IPBaseDelay, MaxDelay: cfg.IPMaxDelay, ResetAfter: cfg.IPResetAfter,
+			},
+		},
+	}
+}
+
+// Check returns a *ThrottledError when a login for email from ip must not
+// be attempted yet. Rejections are audited.
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	var worst *ThrottledError
+	for kind, key := range map[string]string{storage.LoginByEmail: email, storage.LoginByIP: ip} {
+		st, err := g.repo.LoginThrottle(ctx, kind, key)
+		if err != nil {
+			return err
+		}
+		p := g.policy[kind]
+		var e *ThrottledError
+		switch {
+		case st.LockedUntil != nil && st.LockedUntil.After(now):
+			e = &ThrottledError{RetryAfter: st.LockedUntil.Sub(now), Locked: true}
+		case st.Failures > 0 && now.Sub(st.LastFailureAt) < p.ResetAfter:
+			if next := st.LastFailureAt.Add(p.delay(st.Failures)); next.After(now) {
+				e = &ThrottledError{RetryAfter: next.Sub(now)}
+			}
+		}
+		if e != nil && (worst == nil || e.Locked && !worst.Locked || e.RetryAfter > worst.RetryAfter) {
+			worst = e
+		}
+	}
+	if worst == nil {
+		return nil
+	}
+
+	reason := "throttled"
+	if worst.Locked {
+		reason = "locked"
+	}
+	telemetry.IncLoginFailed(reason)
+	if err := g.repo.AddLoginAudit(ctx, storage.LoginAudit{Email: email, IP: ip, Reason: reason}); err != nil {
+		return err
+	}
+	return worst
+}
+
+// Failure records a wrong password (or unknown email) and locks the email
+// or IP once it reaches its policy's limit.
+func (g *LoginGuard) Failure(ctx context.Context, email, ip string) error {
+	telemetry.IncLoginFailed("invalid_credentials")
+	if err := g.repo.AddLoginAudit(ctx, storage.LoginAudit{
+		Email: email, IP: ip, Reason: "invalid_credentials",
+	}); err != nil {
+		return err
+	}
+	for kind, key := range map[string]string{storage.LoginByEmail: email, storage.LoginByIP: ip} {
+		p := g.policy[kind]
+		n, err := g.repo.RecordLoginFailure(ctx, kind, key, p.ResetAfter)
+		if err != nil {
+			return err
+		}
+		if p.MaxFailures > 0 && n >= p.MaxFailures {
+			if err := g.repo.LockLogin(ctx, kind, key, time.Now().Add(p.LockoutFor)); err != nil {
+				return err
+			}
+			if n == p.MaxFailures {
+				telemetry.IncLoginLockouts(kind)
+			}
+		}
+	}
+	return nil
+}
+
+// Success records a successful login and clears the email's failures. The
+// IP's are kept: one valid account must not reset an attacker's budget.
+func (g *LoginGuard) Success(ctx context.Context, u *storage.UserAuth, ip string) error {
+	if err := g.repo.AddLoginAudit(ctx, storage.LoginAudit{
+		Email: u.Email, IP: ip, UserID: &u.ID, Success: true,
+	}); err != nil {
+		return err
+	}
+	return g.repo.ClearLoginFailures(ctx, storage.LoginByEmail, u.Email)
+}
+
+// Unlock lifts a lockout (admin action).
+func (g *LoginGuard) Unlock(ctx context.Context, kind, key string) error {
+	return g.repo.ClearLoginFailures(ctx, kind, key)
+}
@@ -1,29 +1,42 @@
 package auth
 
 import (
-	"errors"
+	"context"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
+	"github.com/AgentTarik/finance-api/internal/config"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-// RequireAuth verifies a Bearer JWT (HS256) and injects "user_id" into the context.
+// Revocations reports whether an access token was revoked (e.g. on logout,
+// password change or deactivation of its user).
+type Revocations interface {
+	IsAccessTokenRevoked(ctx context.Context, userID uuid.UUID, jti string, issuedAt time.Time) (bool, error)
+}
+
+// RequireAuth verifies a Bearer JWT against keys (matched by its kid
+// header), with the issuer, audience and leeway of cfg, and injects
+// "user_id", "role", "scopes", "jti" and "token_exp" into the context.
+// Tokens whose jti is in revoked are rejected; a nil revoked skips the
+// check. An API key (X-API-Key or "Authorization: ApiKey") is accepted
+// instead when apiKeys is set.
 // It returns 401 on missing/invalid token; 403 on claim validation failure.
-func RequireAuth() gin.HandlerFunc {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
+func RequireAuth(cfg config.JWT, keys *KeySet, revoked Revocations, apiKeys APIKeys) gin.HandlerFunc {
+	if keys == nil {
 		// Fail fast at startup: misconfiguration.
-		panic("JWT_SECRET is required for RequireAuth middleware")
+		panic("verification keys are required for RequireAuth middleware")
 	}
-	iss := os.Getenv("JWT_ISS")
-	aud := os.Getenv("JWT_AUD")
 
 	return func(c *gin.Context) {
+		if key := apiKeyFromRequest(c); key != "" {
+			authenticateAPIKey(c, apiKeys, key)
+			return
+		}
+
 		// 1) Extract Bearer token
 		authz := c.GetHeader("Authorization")
 		if !strings.HasPrefix(strings.ToLower(authz), "bearer ") {
@@ -36,39 +49,71 @@ func RequireAuth() gin.HandlerFunc {
 			return
 		}
 
-		// 2) Parse + verify signature (HS256 only) and validate registered claims
-		claims := &jwt.RegisteredClaims{}
+		// 2) Parse + verify signature (key picked by kid, alg pinned to that
+		// key) and validate registered claims
+		claims := &Claims{}
 		token, err := jwt.ParseWithClaims(
 			raw,
 			claims,
-			func(t *jwt.Token) (any, error) {
-				// Enforce HS256
-				if t.Method != jwt.SigningMethodHS256 {
-					return nil, errors.New("unexpected signing method")
-				}
-				return []byte(secret), nil
-			},
-			jwt.WithLeeway(30*time.Second),
-			jwt.WithIssuer(iss),
-			jwt.WithAudience(aud),
+			keys.keyFunc,
+			jwt.WithValidMethods(keys.methods()),
+			jwt.WithLeeway(cfg.Leeway),
+			jwt.WithIssuer(cfg.Issuer),
+			jwt.WithAudience(cfg.Audience),
 		)
 		if err != nil || !token.Valid {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
 
-		// 3) Basic subject sanity check (expect a UUID v4 user id)
+		// 3) Basic subject sanity check (expect a user id: a non-nil UUID of
+		// any version, server-generated ids are v7)
 		if claims.Subject == "" {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid subject"})
 			return
 		}
-		if id, err := uuid.Parse(claims.Subject); err != nil || id.Version() != 4 {
+		userID, err := uuid.Parse(claims.Subject)
+		if err != nil || userID == uuid.Nil {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid subject"})
 			return
 		}
 
-		// 4) Propagate identity to handlers
+		// 4) Reject revoked tokens (logout, stolen token, password change,
+		// deactivated user)
+		if claims.ID == "" || claims.ExpiresAt == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+		if revoked != nil {
+			var issuedAt time.Time
+			if claims.IssuedAt != nil {
+				issuedAt = claims.IssuedAt.Time
+			}
+			isRevoked, err := revoked.IsAccessTokenRevoked(c.Request.Context(), userID, claims.ID, issuedAt)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "token check unavailable"})
+				return
+			}
+			if isRevoked {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+				return
+			}
+		}
+
+		// 5) Propagate identity to handlers
+		role := claims.Role
+		if role == "" {
+			role = RoleUser
+		}
 		c.Set("user_id", claims.Subject)
+		scopes := strings.Fields(claims.Scope)
+		if claims.Scope == "" {
+			scopes = ScopesFor(role, nil) // tokens issued before scopes existed
+		}
+		c.Set("role", role)
+		c.Set("scopes", scopes)
+		c.Set("jti", claims.ID)
+		c.Set("token_exp", claims.ExpiresAt.Time)
 
 		// Continue to the handler
 		c.Next()
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewOpaqueToken returns a random opaque token (refresh tokens, login
+// challenges) and the hash under which it is stored. The token itself is
+// never persisted.
+func NewOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken is the lookup key of an opaque token. The token has 256
+// bits of entropy, so a plain SHA-256 is enough (no salt or slow hash).
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
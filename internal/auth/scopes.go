@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RoleReadOnly = "readonly"
+
+// Scopes are the permissions a token carries (the space-separated "scope"
+// claim). Every route requires one of them.
+const (
+	ScopeTransactionsRead  = "transactions:read"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeReportsRead       = "reports:read"
+	ScopeBalancesRead      = "balances:read"
+	ScopeUsersRead         = "users:read"
+	ScopeEventsRead        = "events:read"        // raw Kafka events (every user's)
+	ScopeDeadLetters       = "dlq:manage"         // inspect, replay and discard the DLQ
+	ScopeTransactionsAdmin = "transactions:admin" // retry and reverse any transaction
+	ScopeUsersAdmin        = "users:admin"        // account administration (e.g. login unlock)
+	ScopeAdminRead         = "admin:read"         // read other users' data (?user_id=, ?all=true)
+)
+
+// roleScopes are the scopes of users without explicitly granted scopes.
+var roleScopes = map[string][]string{
+	RoleUser: {
+		ScopeTransactionsRead, ScopeTransactionsWrite,
+		ScopeReportsRead, ScopeBalancesRead, ScopeUsersRead,
+	},
+	RoleReadOnly: {
+		ScopeTransactionsRead, ScopeReportsRead, ScopeBalancesRead, ScopeUsersRead,
+	},
+	RoleAdmin: {
+		ScopeTransactionsRead, ScopeTransactionsWrite,
+		ScopeReportsRead, ScopeBalancesRead, ScopeUsersRead,
+		ScopeEventsRead, ScopeDeadLetters, ScopeTransactionsAdmin, ScopeUsersAdmin,
+		ScopeAdminRead,
+	},
+}
+
+// ScopesFor returns a user's effective scopes: the explicitly granted ones
+// or, when none are granted, the defaults of the role.
+func ScopesFor(role string, granted []string) []string {
+	if len(granted) > 0 {
+		return granted
+	}
+	return roleScopes[role]
+}
+
+// HasScope reports whether the request's token (or API key) carries scope.
+// It must run after RequireAuth.
+func HasScope(c *gin.Context, scope string) bool {
+	return slices.Contains(c.GetStringSlice("scopes"), scope)
+}
+
+// RequireScope allows only tokens carrying every given scope. It must run
+// after RequireAuth.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		have := c.GetStringSlice("scopes")
+		for _, s := range scopes {
+			if !slices.Contains(have, s) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error":    "insufficient scope",
+					"required": strings.Join(scopes, " "),
+				})
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238 defaults, understood by every authenticator app).
+const (
+	totpPeriod = 30 // seconds
+	totpDigits = 6
+	totpSkew   = 1 // accepted steps before/after the current one
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random 160-bit secret, base32-encoded.
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(b), nil
+}
+
+// TOTPURI is the otpauth:// provisioning URI (usually shown as a QR code).
+func TOTPURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// VerifyTOTP checks code against secret around now. It returns the time
+// step that matched, so callers can refuse to accept the same step twice.
+func VerifyTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	cur := now.Unix() / totpPeriod
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode is the HOTP value (RFC 4226) of one time step.
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, v%1_000_000)
+}
+
+// NewRecoveryCodes returns n single-use recovery codes (80 bits each,
+// formatted XXXX-XXXX-XXXX-XXXX) and their hashes for storage.
+func NewRecoveryCodes(n int) (codes, hashes []string, err error) {
+	for range n {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		s := b32.EncodeToString(b) // 16 chars
+		code := s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode hashes a recovery code, ignoring case, spaces and dashes.
+func HashRecoveryCode(code string) string {
+	norm := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+	sum := sha256.Sum256([]byte(norm))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,265 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// setting is one configurable field of Config.
+type setting struct {
+	key   string // "section.name", as in files and flags
+	env   string
+	help  string
+	value reflect.Value // the field, settable
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// settings lists the fields of c, in declaration order.
+func settings(c *Config) []setting {
+	var out []setting
+	cv := reflect.ValueOf(c).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		section, sv := cv.Type().Field(i), cv.Field(i)
+		for j := 0; j < sv.NumField(); j++ {
+			f := sv.Type().Field(j)
+			out = append(out, setting{
+				key:   section.Tag.Get("key") + "." + f.Tag.Get("key"),
+				env:   f.Tag.Get("env"),
+				help:  f.Tag.Get("help"),
+				value: sv.Field(j),
+			})
+		}
+	}
+	return out
+}
+
+// set parses raw into the field.
+func (s setting) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+	v := s.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q (e.g. 150ms, 30s, 1h)", raw)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q (true or false)", raw)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		panic("config: unsupported field type " + v.Type().String())
+	}
+	return nil
+}
+
+// String renders the current value the way set parses it.
+func (s setting) String() string {
+	v := s.value
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String()
+	case v.Kind() == reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// Flags are the command-line flags of a FlagSet that override settings:
+// -config FILE plus one flag per setting, named by its key (e.g.
+// -worker.concurrency 8).
+type Flags struct {
+	file      *string
+	overrides []override
+}
+
+type override struct {
+	key, raw string
+}
+
+// RegisterFlags adds the configuration flags to fs. Call Load after
+// fs.Parse.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{
+		file: fs.String("config", "", "YAML or TOML configuration file (env CONFIG_FILE)"),
+	}
+	scratch := Default()
+	for _, s := range settings(&scratch) {
+		def := s.String()
+		if s.value.IsZero() {
+			def = "" // keeps flag from printing "(default false)"
+		}
+		fs.Var(&flagValue{flags: f, setting: s, def: def}, s.key, s.help+" (env "+s.env+")")
+	}
+	return f
+}
+
+// flagValue records a flag for Load. Its setting points into a scratch
+// Config, so parsing it there checks the value as soon as it is given.
+type flagValue struct {
+	flags   *Flags
+	setting setting
+	def     string
+}
+
+func (v *flagValue) String() string { return v.def }
+
+func (v *flagValue) Set(raw string) error {
+	if err := v.setting.set(raw); err != nil {
+		return err
+	}
+	v.flags.overrides = append(v.flags.overrides, override{v.setting.key, raw})
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool { return v.setting.value.Kind() == reflect.Bool }
+
+// Load builds the configuration: defaults, then the -config file (or
+// CONFIG_FILE), then environment variables, then the flags given, and
+// validates the result. Empty environment variables count as unset.
+func (f *Flags) Load() (Config, error) {
+	file := os.Getenv("CONFIG_FILE")
+	if f.file != nil && *f.file != "" {
+		file = *f.file
+	}
+	return load(file, f.overrides)
+}
+
+func load(file string, overrides []override) (Config, error) {
+	c := Default()
+	all := settings(&c)
+	byKey := map[string]setting{}
+	for _, s := range all {
+		byKey[s.key] = s
+	}
+
+	if file != "" {
+		values, err := readFile(file)
+		if err != nil {
+			return Config{}, err
+		}
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s, ok := byKey[k]
+			if !ok {
+				return Config{}, fmt.Errorf("%w: %s: unknown setting %q", ErrInvalid, file, k)
+			}
+			if err := s.set(values[k]); err != nil {
+				return Config{}, fmt.Errorf("%w: %s: %s: %v", ErrInvalid, file, k, err)
+			}
+		}
+	}
+
+	for _, s := range all {
+		if raw := os.Getenv(s.env); raw != "" {
+			if err := s.set(raw); err != nil {
+				return Config{}, fmt.Errorf("%w: env %s: %v", ErrInvalid, s.env, err)
+			}
+		}
+	}
+
+	for _, o := range overrides {
+		if err := byKey[o.key].set(o.raw); err != nil {
+			return Config{}, fmt.Errorf("%w: flag -%s: %v", ErrInvalid, o.key, err)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// readFile decodes a YAML (.yaml, .yml) or TOML (.toml) file into
+// "section.name" -> raw value.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	doc := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.NewDecoder(bytes.NewReader(data)).Decode(&doc)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config format (use .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	out := map[string]string{}
+	for name, section := range doc {
+		fields, ok := section.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: %q must be a section of settings", path, name)
+		}
+		for field, v := range fields {
+			raw, err := scalar(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s.%s: %w", path, name, field, err)
+			}
+			out[name+"."+field] = raw
+		}
+	}
+	return out, nil
+}
+
+// scalar renders a decoded file value in the form setting.set parses;
+// lists become comma-separated.
+func scalar(v any) (string, error) {
+	switch v := v.(type) {
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalar(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		return "", fmt.Errorf("unexpected nested section")
+	case nil:
+		return "", nil
+	}
+	return fmt.Sprint(v), nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/AgentTarik/finance-api/internal/config"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -12,12 +13,11 @@ type Producer struct {
 	w *kafka.Writer
 }
 
-func NewProducer(brokers []string, topic string) *Producer {
-	
+func NewProducer(cfg config.Kafka) *Producer {
 	return &Producer{
 		w: &kafka.Writer{
-			Addr:     kafka.TCP(brokers...),
-			Topic:    topic,
+			Addr:     kafka.TCP(cfg.Brokers...),
+			Topic:    cfg.Topic,
 			Balancer: &kafka.LeastBytes{},
 		},
 	}
@@ -36,4 +36,3 @@ func (p *Producer) Publish(ctx context.Context, key string, v any) error {
 }
 
 func (p *Producer) Close() error { return p.w.Close() }
-
@@ -9,7 +9,7 @@ import (
 	"github.com/santhosh-tekuri/jsonschema/v5"
 )
 
-//go:embed schemas/v1/*.json
+//go:embed schemas/*/*.json
 var schemaFS embed.FS
 
 type Validator struct {
@@ -17,7 +17,7 @@ type Validator struct {
 }
 
 func NewValidator() (*Validator, error) {
-	data, err := schemaFS.ReadFile("schemas/v1/transaction_created.v1.json")
+	data, err := schemaFS.ReadFile("schemas/v2/transaction_created.v2.json")
 	if err != nil {
 		return nil, fmt.Errorf("read schema: %w", err)
 	}
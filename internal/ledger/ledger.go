@@ -0,0 +1,164 @@
+// Package ledger models a double-entry bookkeeping ledger: accounts,
+// journal entries and postings. Every entry must balance to zero per
+// currency; account balances are always derived from postings.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/money"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnbalanced      = errors.New("journal entry does not balance")
+	ErrTooFewPostings  = errors.New("journal entry needs at least two postings")
+	ErrZeroPosting     = errors.New("posting amount must be non-zero")
+	ErrAccountNotFound = errors.New("account not found")
+)
+
+type AccountType string
+
+const (
+	Asset     AccountType = "asset"
+	Liability AccountType = "liability"
+	Equity    AccountType = "equity"
+	Revenue   AccountType = "revenue"
+	Expense   AccountType = "expense"
+)
+
+// DebitNormal reports whether debits increase the account's balance.
+func (t AccountType) DebitNormal() bool { return t == Asset || t == Expense }
+
+// EntryKind tells what an entry records for its transaction.
+type EntryKind string
+
+const (
+	KindTransaction EntryKind = "transaction"
+	KindReversal    EntryKind = "reversal"
+)
+
+type Account struct {
+	ID        uuid.UUID
+	Code      string // unique, human-readable key, e.g. "user:<uuid>:BRL"
+	Type      AccountType
+	Currency  string
+	UserID    *uuid.UUID // set for per-user accounts
+	CreatedAt time.Time
+}
+
+// Posting is one leg of an entry. Positive amounts are debits, negative
+// amounts are credits.
+type Posting struct {
+	Account Account
+	Amount  money.Money
+}
+
+type Entry struct {
+	ID            uuid.UUID
+	TransactionID uuid.UUID
+	Kind          EntryKind
+	Description   string
+	PostedAt      time.Time
+	Postings      []Posting
+}
+
+// Validate checks that the entry has at least two non-zero postings whose
+// amounts sum to zero for every currency involved.
+func (e Entry) Validate() error {
+	if len(e.Postings) < 2 {
+		return ErrTooFewPostings
+	}
+	sums := map[string]money.Money{}
+	for _, p := range e.Postings {
+		if p.Amount.IsZero() {
+			return ErrZeroPosting
+		}
+		if p.Account.Currency != p.Amount.Currency() {
+			return fmt.Errorf("%w: account %s is %s", money.ErrCurrencyMismatch, p.Account.Code, p.Account.Currency)
+		}
+		s, err := sums[p.Amount.Currency()].Add(p.Amount)
+		if err != nil {
+			return err
+		}
+		sums[p.Amount.Currency()] = s
+	}
+	for cur, s := range sums {
+		if !s.IsZero() {
+			return fmt.Errorf("%w: %s off by %s", ErrUnbalanced, cur, s)
+		}
+	}
+	return nil
+}
+
+// Balance converts a raw posting sum (debits minus credits) into the
+// account's balance according to its normal side.
+func Balance(t AccountType, postingSum money.Money) money.Money {
+	if t.DebitNormal() {
+		return postingSum
+	}
+	return postingSum.Neg()
+}
+
+// SettlementAccount is the platform's clearing account for a currency.
+func SettlementAccount(currency string) Account {
+	return Account{
+		ID:       uuid.New(),
+		Code:     "settlement:" + currency,
+		Type:     Asset,
+		Currency: currency,
+	}
+}
+
+// UserAccount is the wallet the platform owes to a user in a currency.
+func UserAccount(userID uuid.UUID, currency string) Account {
+	uid := userID
+	return Account{
+		ID:       uuid.New(),
+		Code:     UserAccountCode(userID, currency),
+		Type:     Liability,
+		Currency: currency,
+		UserID:   &uid,
+	}
+}
+
+func UserAccountCode(userID uuid.UUID, currency string) string {
+	return "user:" + userID.String() + ":" + currency
+}
+
+// TransactionEntry builds the entry for an incoming user transaction:
+// debit the settlement account, credit the user's wallet.
+func TransactionEntry(txID, userID uuid.UUID, amount money.Money, postedAt time.Time) (Entry, error) {
+	if !amount.IsPositive() {
+		return Entry{}, fmt.Errorf("%w: transaction amount must be positive", money.ErrInvalidAmount)
+	}
+	e := Entry{
+		ID:            uuid.New(),
+		TransactionID: txID,
+		Kind:          KindTransaction,
+		Description:   "transaction " + txID.String(),
+		PostedAt:      postedAt,
+		Postings: []Posting{
+			{Account: SettlementAccount(amount.Currency()), Amount: amount},
+			{Account: UserAccount(userID, amount.Currency()), Amount: amount.Neg()},
+		},
+	}
+	return e, e.Validate()
+}
+
+// ReversalEntry undoes TransactionEntry: credit the settlement account,
+// debit the user's wallet.
+func ReversalEntry(txID, userID uuid.UUID, amount money.Money, postedAt time.Time) (Entry, error) {
+	e, err := TransactionEntry(txID, userID, amount, postedAt)
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Kind = KindReversal
+	e.Description = "reversal of transaction " + txID.String()
+	for i := range e.Postings {
+		e.Postings[i].Amount = e.Postings[i].Amount.Neg()
+	}
+	return e, e.Validate()
+}
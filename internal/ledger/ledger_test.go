@@ -0,0 +1,120 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/money"
+	"github.com/google/uuid"
+)
+
+func amount(t *testing.T, s, currency string) money.Money {
+	t.Helper()
+	m, err := money.Parse(s, currency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestEntryValidate(t *testing.T) {
+	user := uuid.New()
+	brl, usd := SettlementAccount("BRL"), SettlementAccount("USD")
+	wallet, usdWallet := UserAccount(user, "BRL"), UserAccount(user, "USD")
+	ten, minusTen := amount(t, "10.00", "BRL"), amount(t, "-10.00", "BRL")
+
+	tests := []struct {
+		name     string
+		postings []Posting
+		err      error
+	}{
+		{"balanced", []Posting{{brl, ten}, {wallet, minusTen}}, nil},
+		{"balanced over three legs", []Posting{
+			{brl, ten}, {wallet, amount(t, "-4.00", "BRL")}, {wallet, amount(t, "-6.00", "BRL")},
+		}, nil},
+		{"balanced per currency", []Posting{
+			{brl, ten}, {wallet, minusTen},
+			{usd, amount(t, "3.00", "USD")}, {usdWallet, amount(t, "-3.00", "USD")},
+		}, nil},
+		{"unbalanced", []Posting{{brl, ten}, {wallet, amount(t, "-9.99", "BRL")}}, ErrUnbalanced},
+		{"one-sided", []Posting{{brl, ten}, {wallet, ten}}, ErrUnbalanced},
+		// the totals match, but not within each currency
+		{"balanced only across currencies", []Posting{
+			{brl, ten}, {usdWallet, amount(t, "-10.00", "USD")},
+		}, ErrUnbalanced},
+		{"account and posting currency differ", []Posting{
+			{brl, ten}, {usdWallet, minusTen},
+		}, money.ErrCurrencyMismatch},
+		{"zero posting", []Posting{
+			{brl, ten}, {wallet, minusTen}, {wallet, amount(t, "0", "BRL")},
+		}, ErrZeroPosting},
+		{"one posting", []Posting{{brl, ten}}, ErrTooFewPostings},
+		{"no postings", nil, ErrTooFewPostings},
+	}
+	for _, tc := range tests {
+		err := Entry{Postings: tc.postings}.Validate()
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestTransactionEntry(t *testing.T) {
+	txID, user := uuid.New(), uuid.New()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	e, err := TransactionEntry(txID, user, amount(t, "12.34", "BRL"), at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Kind != KindTransaction || e.TransactionID != txID || !e.PostedAt.Equal(at) {
+		t.Errorf("got entry %+v, want a transaction entry for %s at %s", e, txID, at)
+	}
+	if len(e.Postings) != 2 {
+		t.Fatalf("got %d postings, want 2", len(e.Postings))
+	}
+	debit, credit := e.Postings[0], e.Postings[1]
+	if debit.Account.Code != "settlement:BRL" || debit.Amount.Minor() != 1234 {
+		t.Errorf("debit: got %s %s, want settlement:BRL 12.34", debit.Account.Code, debit.Amount)
+	}
+	if credit.Account.Code != UserAccountCode(user, "BRL") || credit.Amount.Minor() != -1234 {
+		t.Errorf("credit: got %s %s, want the user's wallet -12.34", credit.Account.Code, credit.Amount)
+	}
+	if b := Balance(credit.Account.Type, credit.Amount); b.Minor() != 1234 {
+		t.Errorf("wallet balance: got %s, want 12.34", b)
+	}
+
+	for _, s := range []string{"0", "-1.00"} {
+		if _, err := TransactionEntry(txID, user, amount(t, s, "BRL"), at); !errors.Is(err, money.ErrInvalidAmount) {
+			t.Errorf("TransactionEntry(%s): got error %v, want %v", s, err, money.ErrInvalidAmount)
+		}
+	}
+}
+
+func TestReversalEntry(t *testing.T) {
+	txID, user := uuid.New(), uuid.New()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, a := range []money.Money{amount(t, "12.34", "BRL"), amount(t, "1500", "JPY"), amount(t, "0.001", "BHD")} {
+		orig, err := TransactionEntry(txID, user, a, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rev, err := ReversalEntry(txID, user, a, at.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rev.Kind != KindReversal || rev.TransactionID != txID || rev.ID == orig.ID {
+			t.Errorf("%s: got reversal %+v, want a new reversal entry for %s", a, rev, txID)
+		}
+		if len(rev.Postings) != len(orig.Postings) {
+			t.Fatalf("%s: got %d postings, want %d", a, len(rev.Postings), len(orig.Postings))
+		}
+		for i, p := range rev.Postings {
+			o := orig.Postings[i]
+			if p.Account.Code != o.Account.Code || p.Account.Type != o.Account.Type || p.Amount != o.Amount.Neg() {
+				t.Errorf("%s: posting %d: got %s %s, want %s %s", a, i, p.Account.Code, p.Amount, o.Account.Code, o.Amount.Neg())
+			}
+		}
+	}
+}
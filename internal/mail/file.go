@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// FileMailer writes every message to an .eml file in a directory instead of
+// sending it (local development, tests).
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (f *FileMailer) Send(_ context.Context, m Message) error {
+	msg, err := format(f.from, m)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.NewString()[:8])
+	return os.WriteFile(filepath.Join(f.dir, name), msg, 0o640)
+}
+
+// LogMailer logs every message instead of sending it. The body holds
+// live tokens, so it is meant for local use only.
+type LogMailer struct {
+	log *zap.Logger
+}
+
+func NewLogMailer(log *zap.Logger) *LogMailer { return &LogMailer{log: log} }
+
+func (l *LogMailer) Send(_ context.Context, m Message) error {
+	l.log.Info("mail (not sent)",
+		zap.String("to", m.To),
+		zap.String("subject", m.Subject),
+		zap.String("body", m.Body))
+	return nil
+}
@@ -0,0 +1,66 @@
+// Package mail sends the emails of the account flows (verification,
+// password reset).
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/config"
+	"go.uber.org/zap"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// New picks the mailer cfg asks for: an SMTP relay, .eml files in a
+// directory or, when neither is set, the log.
+func New(cfg config.Mail, log *zap.Logger) (Mailer, error) {
+	switch {
+	case cfg.SMTPAddr != "":
+		log.Info("smtp mailer enabled", zap.String("addr", cfg.SMTPAddr))
+		return NewSMTPMailer(cfg.SMTPAddr, cfg.From, cfg.SMTPUser, cfg.SMTPPassword), nil
+	case cfg.Dir != "":
+		fm, err := NewFileMailer(cfg.Dir, cfg.From)
+		if err != nil {
+			return nil, fmt.Errorf("file mailer init: %w", err)
+		}
+		log.Info("file mailer enabled", zap.String("dir", cfg.Dir))
+		return fm, nil
+	}
+	log.Warn("no mail.smtp_addr or mail.dir; emails are only logged")
+	return NewLogMailer(log), nil
+}
+
+// format renders m as an RFC 5322 message from from.
+func format(from string, m Message) ([]byte, error) {
+	for _, h := range []string{from, m.To, m.Subject} {
+		if strings.ContainsAny(h, "\r\n") {
+			return nil, errors.New("mail: header contains a line break")
+		}
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return b.Bytes(), nil
+}
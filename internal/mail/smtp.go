@@ -0,0 +1,38 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+)
+
+// SMTPMailer sends through an SMTP relay, upgrading to TLS when the server
+// offers STARTTLS.
+type SMTPMailer struct {
+	addr string // host:port
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer sends from from through addr; PLAIN auth is used when
+// username is set (net/smtp only sends it over TLS or to localhost).
+func NewSMTPMailer(addr, from, username, password string) *SMTPMailer {
+	m := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (s *SMTPMailer) Send(ctx context.Context, m Message) error {
+	msg, err := format(s.from, m)
+	if err != nil {
+		return err
+	}
+	// net/smtp takes no context; honour a context that is already done
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{m.To}, msg)
+}
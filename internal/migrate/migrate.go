@@ -0,0 +1,327 @@
+// Package migrate applies the versioned SQL schema embedded in the binary.
+// Migrations are file pairs sql/NNN_name.up.sql and sql/NNN_name.down.sql;
+// applied versions are recorded in schema_migrations, and a Postgres
+// advisory lock keeps replicas starting together from racing each other.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey is the pg_advisory_lock key shared by every replica ("finance").
+const lockKey int64 = 0x66696e616e6365
+
+const createTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+	  version    BIGINT      PRIMARY KEY,
+	  name       TEXT        NOT NULL,
+	  applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrUnknownVersion is returned when the database holds a version this
+// binary has no migration for, or a version to force does not exist.
+var ErrUnknownVersion = errors.New("unknown migration version")
+
+// Migration is one schema change and its rollback.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied (nil: pending).
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// load reads the migrations in dir of fsys, sorted by version. Every
+// version needs both an up and a down file.
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		match := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		dst := &m.Up
+		if match[3] == "down" {
+			dst = &m.Down
+		}
+		if *dst != "" {
+			return nil, fmt.Errorf("migration %s is duplicated", e.Name())
+		}
+		*dst = string(body)
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %03d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Migrator runs migrations against one database.
+type Migrator struct {
+	db         *sql.DB
+	log        *zap.Logger
+	migrations []Migration
+}
+
+// New returns a Migrator for the migrations embedded in the binary.
+func New(db *sql.DB, log *zap.Logger) (*Migrator, error) {
+	ms, err := load(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, log: log, migrations: ms}, nil
+}
+
+// locked runs fn on a dedicated connection holding the advisory lock, after
+// making sure schema_migrations exists.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			// the lock lives as long as the session: drop the connection
+			// instead of returning it to the pool still locked
+			m.log.Warn("release migration lock failed", zap.Error(err))
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// applied returns the applied versions and when each was applied.
+func applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int64]time.Time{}
+	for rows.Next() {
+		var (
+			v  int64
+			at time.Time
+		)
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		out[v] = at
+	}
+	return out, rows.Err()
+}
+
+// run executes one migration script and its schema_migrations bookkeeping
+// in a single transaction.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	script, record := mig.Down, `DELETE FROM schema_migrations WHERE version = $1`
+	if up {
+		script, record = mig.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+	}
+	start := time.Now()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %03d_%s: %w", mig.Version, mig.Name, err)
+	}
+	args := []any{mig.Version}
+	if up {
+		args = append(args, mig.Name)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.log.Info("migration done",
+		zap.Int64("version", mig.Version),
+		zap.String("name", mig.Name),
+		zap.Bool("up", up),
+		zap.Duration("dur", time.Since(start)))
+	return nil
+}
+
+// Up applies every pending migration in order and returns how many ran.
+// Versions applied by a newer binary are left alone.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for v := range done {
+			if _, ok := m.find(v); !ok {
+				m.log.Warn("database has a migration this binary does not know", zap.Int64("version", v))
+			}
+		}
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Down rolls back the last steps applied migrations, newest first, and
+// returns how many were rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	if steps < 1 {
+		return 0, errors.New("steps must be at least 1")
+	}
+	n := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(done))
+		for v := range done {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+		for _, v := range versions[:min(steps, len(versions))] {
+			mig, ok := m.find(v)
+			if !ok {
+				return fmt.Errorf("roll back version %d: %w", v, ErrUnknownVersion)
+			}
+			if err := m.run(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Status lists every known migration with its applied time.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var out []Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			s := Status{Migration: mig}
+			if at, ok := done[mig.Version]; ok {
+				s.AppliedAt = &at
+			}
+			out = append(out, s)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Force records the schema as being at version without running any SQL:
+// migrations up to it are marked applied, later ones pending. It brings
+// databases created outside the runner (e.g. by the old docker-entrypoint
+// scripts) under its control; version 0 clears the record.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if _, ok := m.find(version); !ok && version != 0 {
+		return fmt.Errorf("force version %d: %w", version, ErrUnknownVersion)
+	}
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version > $1`, version); err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if mig.Version > version {
+				break
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO schema_migrations (version, name) VALUES ($1, $2)
+				ON CONFLICT (version) DO NOTHING`, mig.Version, mig.Name); err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		m.log.Warn("migration version forced", zap.Int64("version", version))
+		return nil
+	})
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
@@ -0,0 +1,4 @@
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_amount_positive;
+ALTER TABLE transactions DROP COLUMN IF EXISTS currency;
+ALTER TABLE transactions
+  ALTER COLUMN amount TYPE DOUBLE PRECISION USING amount::DOUBLE PRECISION;
@@ -0,0 +1,11 @@
+-- exact money: NUMERIC amounts + ISO-4217 currency code
+ALTER TABLE transactions
+  ALTER COLUMN amount TYPE NUMERIC(20,4) USING amount::NUMERIC(20,4);
+
+ALTER TABLE transactions
+  ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'BRL';
+ALTER TABLE transactions
+  ALTER COLUMN currency DROP DEFAULT;
+
+ALTER TABLE transactions
+  ADD CONSTRAINT transactions_amount_positive CHECK (amount > 0);
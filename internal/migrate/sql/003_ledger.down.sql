@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS ledger_postings_balanced ON ledger_postings;
+DROP FUNCTION IF EXISTS ledger_check_balanced();
+DROP TABLE IF EXISTS ledger_postings;
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_accounts;
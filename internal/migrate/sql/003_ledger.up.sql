@@ -0,0 +1,48 @@
+-- double-entry ledger: accounts, journal entries and postings
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+  id         UUID PRIMARY KEY,
+  code       TEXT        NOT NULL UNIQUE,
+  type       TEXT        NOT NULL CHECK (type IN ('asset', 'liability', 'equity', 'revenue', 'expense')),
+  currency   CHAR(3)     NOT NULL,
+  user_id    UUID        REFERENCES users(id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+  id             UUID PRIMARY KEY,
+  transaction_id UUID        UNIQUE REFERENCES transactions(transaction_id),
+  description    TEXT        NOT NULL,
+  posted_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS ledger_postings (
+  id         BIGSERIAL PRIMARY KEY,
+  entry_id   UUID          NOT NULL REFERENCES ledger_entries(id),
+  account_id UUID          NOT NULL REFERENCES ledger_accounts(id),
+  amount     NUMERIC(20,4) NOT NULL CHECK (amount <> 0),
+  currency   CHAR(3)       NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_account_id ON ledger_postings(account_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_entry_id ON ledger_postings(entry_id);
+
+-- entries must balance to zero per currency; checked at commit time
+CREATE OR REPLACE FUNCTION ledger_check_balanced() RETURNS trigger AS $$
+BEGIN
+  IF EXISTS (
+    SELECT 1 FROM ledger_postings
+    WHERE entry_id = NEW.entry_id
+    GROUP BY currency
+    HAVING SUM(amount) <> 0
+  ) THEN
+    RAISE EXCEPTION 'ledger entry % is not balanced', NEW.entry_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_postings_balanced ON ledger_postings;
+CREATE CONSTRAINT TRIGGER ledger_postings_balanced
+  AFTER INSERT OR UPDATE ON ledger_postings
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW EXECUTE FUNCTION ledger_check_balanced();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_ledger_entries_posted_at;
+DROP TABLE IF EXISTS account_balances;
@@ -0,0 +1,23 @@
+-- materialized per-user balances, maintained in the same DB transaction as postings
+CREATE TABLE IF NOT EXISTS account_balances (
+  user_id    UUID          NOT NULL REFERENCES users(id),
+  currency   CHAR(3)       NOT NULL,
+  balance    NUMERIC(20,4) NOT NULL DEFAULT 0,
+  updated_at TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, currency)
+);
+
+-- backfill from postings already in the ledger
+INSERT INTO account_balances (user_id, currency, balance, updated_at)
+SELECT a.user_id,
+       a.currency,
+       SUM(CASE WHEN a.type IN ('asset', 'expense') THEN p.amount ELSE -p.amount END),
+       MAX(e.posted_at)
+FROM ledger_postings p
+JOIN ledger_accounts a ON a.id = p.account_id
+JOIN ledger_entries e  ON e.id = p.entry_id
+WHERE a.user_id IS NOT NULL
+GROUP BY a.user_id, a.currency
+ON CONFLICT (user_id, currency) DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_posted_at ON ledger_entries(posted_at);
@@ -0,0 +1,15 @@
+-- transactional outbox: events are written with the state change and relayed to Kafka
+CREATE TABLE IF NOT EXISTS outbox (
+  id            BIGSERIAL PRIMARY KEY,
+  aggregate_id  UUID        NOT NULL,
+  event_type    TEXT        NOT NULL,
+  payload       JSONB       NOT NULL,
+  status        TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'dispatched')),
+  attempts      INT         NOT NULL DEFAULT 0,
+  last_error    TEXT,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  available_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  dispatched_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(available_at, id) WHERE status = 'pending';
@@ -0,0 +1,7 @@
+-- 'dead' outbox rows only make sense next to their dead letters
+DELETE FROM outbox WHERE status = 'dead';
+ALTER TABLE outbox DROP CONSTRAINT IF EXISTS outbox_status_check;
+ALTER TABLE outbox
+  ADD CONSTRAINT outbox_status_check CHECK (status IN ('pending', 'dispatched'));
+
+DROP TABLE IF EXISTS dead_letters;
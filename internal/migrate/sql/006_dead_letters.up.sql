@@ -0,0 +1,20 @@
+-- dead-letter queue for events that failed schema validation or publishing
+CREATE TABLE IF NOT EXISTS dead_letters (
+  id           UUID PRIMARY KEY,
+  source       TEXT        NOT NULL CHECK (source IN ('schema', 'publish')),
+  aggregate_id UUID        NOT NULL,
+  event_type   TEXT        NOT NULL,
+  payload      JSONB       NOT NULL,
+  reason       TEXT        NOT NULL,
+  attempts     INT         NOT NULL DEFAULT 0,
+  status       TEXT        NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'replayed', 'discarded')),
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  resolved_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_status ON dead_letters(status, created_at);
+
+-- outbox rows moved to the DLQ are kept as 'dead'
+ALTER TABLE outbox DROP CONSTRAINT IF EXISTS outbox_status_check;
+ALTER TABLE outbox
+  ADD CONSTRAINT outbox_status_check CHECK (status IN ('pending', 'dispatched', 'dead'));
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_transactions_queued;
+ALTER TABLE transactions DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE transactions DROP COLUMN IF EXISTS lease_owner;
+ALTER TABLE transactions DROP COLUMN IF EXISTS attempts;
+ALTER TABLE transactions DROP COLUMN IF EXISTS queued_at;
@@ -0,0 +1,8 @@
+-- durable worker queue: queued rows are claimed with leases (visibility timeouts)
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS queued_at        TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS attempts         INT         NOT NULL DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS lease_owner      TEXT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_queued
+  ON transactions(queued_at, transaction_id) WHERE status = 'queued';
@@ -0,0 +1,3 @@
+-- per-user ordering check in the queue claim looks up a user's queued rows
+CREATE INDEX IF NOT EXISTS idx_transactions_user_queued
+  ON transactions(user_id, lease_expires_at) WHERE status = 'queued';
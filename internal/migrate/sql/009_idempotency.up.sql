@@ -0,0 +1,12 @@
+-- Idempotency-Key support: request fingerprint + stored response per user and key
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  user_id     UUID        NOT NULL REFERENCES users(id),
+  key         TEXT        NOT NULL,
+  fingerprint TEXT        NOT NULL,
+  status_code INT,         -- NULL while the first request is in flight
+  response    BYTEA,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
@@ -0,0 +1,16 @@
+-- one entry per transaction again: refuse rather than drop posted reversals
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM ledger_entries WHERE kind = 'reversal') THEN
+    RAISE EXCEPTION 'ledger has reversal entries; cannot roll back 010_status_history';
+  END IF;
+END;
+$$;
+
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_transaction_kind_key;
+ALTER TABLE ledger_entries
+  ADD CONSTRAINT ledger_entries_transaction_id_key UNIQUE (transaction_id);
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS kind;
+
+DROP TABLE IF EXISTS transaction_status_history;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_status_check;
@@ -0,0 +1,30 @@
+-- explicit transaction state machine: allowed states + transition history
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_status_check;
+ALTER TABLE transactions
+  ADD CONSTRAINT transactions_status_check
+  CHECK (status IN ('queued', 'processed', 'failed', 'reversed', 'cancelled'));
+
+CREATE TABLE IF NOT EXISTS transaction_status_history (
+  id             BIGSERIAL PRIMARY KEY,
+  transaction_id UUID        NOT NULL REFERENCES transactions(transaction_id),
+  from_status    TEXT,
+  to_status      TEXT        NOT NULL,
+  reason         TEXT        NOT NULL DEFAULT '',
+  changed_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_status_history_tx ON transaction_status_history(transaction_id, id);
+
+-- existing rows start their history in their current state
+INSERT INTO transaction_status_history (transaction_id, from_status, to_status, reason, changed_at)
+SELECT t.transaction_id, NULL, t.status, 'backfill', t.queued_at
+FROM transactions t
+WHERE NOT EXISTS (SELECT 1 FROM transaction_status_history h WHERE h.transaction_id = t.transaction_id);
+
+-- a transaction can now have its posting and a reversal entry
+ALTER TABLE ledger_entries
+  ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'transaction' CHECK (kind IN ('transaction', 'reversal'));
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_transaction_id_key;
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_transaction_kind_key;
+ALTER TABLE ledger_entries
+  ADD CONSTRAINT ledger_entries_transaction_kind_key UNIQUE (transaction_id, kind);
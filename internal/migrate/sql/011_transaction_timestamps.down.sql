@@ -0,0 +1,4 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS last_error;
+ALTER TABLE transactions DROP COLUMN IF EXISTS processed_at;
+ALTER TABLE transactions DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE transactions DROP COLUMN IF EXISTS created_at;
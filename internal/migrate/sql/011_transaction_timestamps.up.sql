@@ -0,0 +1,10 @@
+-- lifecycle timestamps and the last processing error, for GET /v1/transactions/:id
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS processed_at TIMESTAMPTZ;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS last_error   TEXT;
+
+UPDATE transactions t
+SET created_at = t.queued_at,
+    updated_at = COALESCE((SELECT MAX(h.changed_at) FROM transaction_status_history h WHERE h.transaction_id = t.transaction_id), t.queued_at),
+    processed_at = (SELECT MAX(e.posted_at) FROM ledger_entries e WHERE e.transaction_id = t.transaction_id AND e.kind = 'transaction');
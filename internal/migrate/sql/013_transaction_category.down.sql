@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transactions_ts_id;
+DROP INDEX IF EXISTS idx_transactions_user_ts_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS category;
@@ -0,0 +1,6 @@
+-- optional category per transaction, used for filtering and reports
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT '';
+
+-- keyset pagination walks (timestamp, transaction_id)
+CREATE INDEX IF NOT EXISTS idx_transactions_user_ts_id ON transactions (user_id, timestamp, transaction_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_ts_id ON transactions (timestamp, transaction_id);
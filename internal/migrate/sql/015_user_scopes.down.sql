@@ -0,0 +1,12 @@
+-- readonly users would silently become full users: refuse instead
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM users WHERE role = 'readonly') THEN
+    RAISE EXCEPTION 'readonly users exist; cannot roll back 015_user_scopes';
+  END IF;
+END;
+$$;
+
+ALTER TABLE users DROP COLUMN IF EXISTS scopes;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'admin'));
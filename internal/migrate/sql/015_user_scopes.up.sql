@@ -0,0 +1,6 @@
+-- read-only clients get their own role
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'readonly', 'admin'));
+
+-- space-separated scopes; empty means the role's default scopes
+ALTER TABLE users ADD COLUMN IF NOT EXISTS scopes TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,23 @@
+-- failed login tracking, per email and per client IP (shared by all replicas)
+CREATE TABLE IF NOT EXISTS login_throttle (
+  kind            TEXT        NOT NULL CHECK (kind IN ('email', 'ip')),
+  key             TEXT        NOT NULL,
+  failures        INT         NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMPTZ NOT NULL,
+  locked_until    TIMESTAMPTZ,
+  PRIMARY KEY (kind, key)
+);
+
+-- audit trail of every login attempt
+CREATE TABLE IF NOT EXISTS login_audit (
+  id         BIGSERIAL   PRIMARY KEY,
+  email      TEXT        NOT NULL,
+  ip         TEXT        NOT NULL,
+  user_id    UUID,
+  success    BOOLEAN     NOT NULL,
+  reason     TEXT        NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_audit_email ON login_audit (email, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_audit_ip ON login_audit (ip, created_at DESC);
@@ -0,0 +1,23 @@
+-- TOTP two-factor authentication. The secret must stay readable to verify
+-- codes; totp_last_step stops a code from being accepted twice.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret    TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled   BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT  NOT NULL DEFAULT 0;
+
+-- single-use recovery codes, stored hashed
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  user_id    UUID        NOT NULL REFERENCES users(id),
+  code_hash  TEXT        NOT NULL,
+  used_at    TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, code_hash)
+);
+
+-- second login step: password checked, code still due
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+  token_hash TEXT        PRIMARY KEY,
+  user_id    UUID        NOT NULL REFERENCES users(id),
+  expires_at TIMESTAMPTZ NOT NULL,
+  attempts   INT         NOT NULL DEFAULT 0,
+  used_at    TIMESTAMPTZ
+);
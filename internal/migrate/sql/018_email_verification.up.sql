@@ -0,0 +1,15 @@
+-- email verification; NULL until the user follows the mailed link
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+-- single-use action tokens (email verification, password reset). The tokens
+-- are signed and carry their expiry; only their id is kept, to spend them.
+CREATE TABLE IF NOT EXISTS action_tokens (
+  id         TEXT        PRIMARY KEY,
+  user_id    UUID        NOT NULL REFERENCES users(id),
+  purpose    TEXT        NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_action_tokens_user ON action_tokens (user_id, purpose);
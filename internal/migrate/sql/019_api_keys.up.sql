@@ -0,0 +1,16 @@
+-- API keys for machine-to-machine clients. Only a hash of the key is kept;
+-- the prefix identifies a key in listings without revealing it.
+CREATE TABLE IF NOT EXISTS api_keys (
+  id           UUID PRIMARY KEY,
+  user_id      UUID        NOT NULL REFERENCES users(id),
+  name         TEXT        NOT NULL,
+  prefix       TEXT        NOT NULL UNIQUE,
+  key_hash     TEXT        NOT NULL UNIQUE,
+  scopes       TEXT        NOT NULL, -- space-separated, as users.scopes
+  expires_at   TIMESTAMPTZ,          -- NULL: never
+  last_used_at TIMESTAMPTZ,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys (user_id) WHERE revoked_at IS NULL;
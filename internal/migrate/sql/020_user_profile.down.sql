@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_revoked_before;
+ALTER TABLE users DROP COLUMN IF EXISTS deactivated_at;
+ALTER TABLE users DROP COLUMN IF EXISTS updated_at;
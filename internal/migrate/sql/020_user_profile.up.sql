@@ -0,0 +1,8 @@
+-- profile updates and deactivation (soft delete: the row stays, since
+-- transactions and the ledger reference it)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+
+-- access tokens issued before this instant are rejected (password change,
+-- deactivation): their jtis are not known, so they cannot be listed one by one
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_revoked_before TIMESTAMPTZ;
@@ -0,0 +1,4 @@
+-- fails with a numeric overflow if any stored amount needs the wider type
+ALTER TABLE account_balances ALTER COLUMN balance TYPE NUMERIC(20,4);
+ALTER TABLE ledger_postings  ALTER COLUMN amount  TYPE NUMERIC(20,4);
+ALTER TABLE transactions     ALTER COLUMN amount  TYPE NUMERIC(20,4);
@@ -0,0 +1,6 @@
+-- NUMERIC(20,4) holds 16 integer digits, fewer than the int64 minor units
+-- money.Parse accepts (up to 19 digits for zero-decimal currencies);
+-- NUMERIC(24,4) stores every amount the API validates
+ALTER TABLE transactions     ALTER COLUMN amount  TYPE NUMERIC(24,4);
+ALTER TABLE ledger_postings  ALTER COLUMN amount  TYPE NUMERIC(24,4);
+ALTER TABLE account_balances ALTER COLUMN balance TYPE NUMERIC(24,4);
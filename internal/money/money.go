@@ -0,0 +1,194 @@
+// Package money implements exact monetary amounts.
+//
+// Amounts are stored as integer minor units (e.g. cents) together with an
+// ISO-4217 currency code, so sums never drift the way float64 values do.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrInvalidCurrency  = errors.New("invalid currency")
+	ErrTooPrecise       = errors.New("amount has more decimal places than the currency allows")
+	ErrOverflow         = errors.New("amount out of range")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// minorUnits lists the ISO-4217 currencies whose minor unit is not 2 digits.
+var minorUnits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// Money is an amount in minor units of a currency. The zero value is an
+// empty amount without currency.
+type Money struct {
+	minor    int64
+	currency string
+}
+
+// New builds a Money from minor units (e.g. 1234 BRL == 12.34 BRL).
+func New(minor int64, currency string) (Money, error) {
+	cur, err := normalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{minor: minor, currency: cur}, nil
+}
+
+// Zero returns a zero amount in the given currency.
+func Zero(currency string) (Money, error) { return New(0, currency) }
+
+// Parse reads a decimal string such as "12.34" or "-0.5" without going
+// through floating point. Trailing zeros beyond the currency exponent are
+// accepted (NUMERIC columns render "12.3400"); significant extra digits are not.
+func Parse(s, currency string) (Money, error) {
+	cur, err := normalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	exp := Exponent(cur)
+
+	s = strings.TrimSpace(s)
+	neg := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		neg, s = true, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	intPart, frac, hasDot := strings.Cut(s, ".")
+	if intPart == "" || (hasDot && frac == "") || !isDigits(intPart) || !isDigits(frac) {
+		return Money{}, ErrInvalidAmount
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > exp {
+		return Money{}, ErrTooPrecise
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+
+	v, err := strconv.ParseInt(intPart+frac, 10, 64)
+	if err != nil {
+		return Money{}, ErrOverflow
+	}
+	if neg {
+		v = -v
+	}
+	return Money{minor: v, currency: cur}, nil
+}
+
+// ValidDecimal reports whether s is a plain decimal literal (digits with an
+// optional fractional part). It does not check currency precision.
+func ValidDecimal(s string) bool {
+	intPart, frac, hasDot := strings.Cut(s, ".")
+	return intPart != "" && !(hasDot && frac == "") && isDigits(intPart) && isDigits(frac)
+}
+
+// Exponent returns the number of minor-unit digits for a currency.
+func Exponent(currency string) int {
+	if e, ok := minorUnits[currency]; ok {
+		return e
+	}
+	return 2
+}
+
+func (m Money) Minor() int64     { return m.minor }
+func (m Money) Currency() string { return m.currency }
+func (m Money) IsZero() bool     { return m.minor == 0 }
+func (m Money) IsPositive() bool { return m.minor > 0 }
+func (m Money) Neg() Money       { return Money{minor: -m.minor, currency: m.currency} }
+func (m Money) Sign() int        { return sign(m.minor) }
+
+// Add returns m + o. Both operands must share the same currency; a zero
+// value without currency adopts the other operand's currency.
+func (m Money) Add(o Money) (Money, error) {
+	switch {
+	case m.currency == "":
+		m.currency = o.currency
+	case o.currency != "" && o.currency != m.currency:
+		return Money{}, fmt.Errorf("%w: %s vs %s", ErrCurrencyMismatch, m.currency, o.currency)
+	}
+	sum := m.minor + o.minor
+	if (o.minor > 0 && sum < m.minor) || (o.minor < 0 && sum > m.minor) {
+		return Money{}, ErrOverflow
+	}
+	return Money{minor: sum, currency: m.currency}, nil
+}
+
+// Cmp compares m and o, returning -1, 0 or +1. Both must share a currency.
+func (m Money) Cmp(o Money) (int, error) {
+	if m.currency != o.currency {
+		return 0, fmt.Errorf("%w: %s vs %s", ErrCurrencyMismatch, m.currency, o.currency)
+	}
+	switch {
+	case m.minor < o.minor:
+		return -1, nil
+	case m.minor > o.minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// String renders the amount as a decimal string with exactly the currency's
+// number of decimal places (e.g. "12.30"), without the currency code.
+func (m Money) String() string {
+	exp := Exponent(m.currency)
+	var abs uint64
+	if m.minor < 0 {
+		abs = uint64(-(m.minor + 1)) + 1 // safe for MinInt64
+	} else {
+		abs = uint64(m.minor)
+	}
+	digits := strconv.FormatUint(abs, 10)
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	out := digits
+	if exp > 0 {
+		out = digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+	}
+	if m.minor < 0 {
+		out = "-" + out
+	}
+	return out
+}
+
+func normalizeCurrency(c string) (string, error) {
+	c = strings.ToUpper(strings.TrimSpace(c))
+	if len(c) != 3 {
+		return "", ErrInvalidCurrency
+	}
+	for i := 0; i < len(c); i++ {
+		if c[i] < 'A' || c[i] > 'Z' {
+			return "", ErrInvalidCurrency
+		}
+	}
+	return c, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func sign(v int64) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
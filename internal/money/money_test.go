@@ -0,0 +1,146 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in, currency string
+		minor        int64
+		err          error
+	}{
+		{"12.34", "BRL", 1234, nil},
+		{"12.3", "brl", 1230, nil},
+		{"12", "BRL", 1200, nil},
+		{"+12.34", "BRL", 1234, nil},
+		{" 12.34 ", "BRL", 1234, nil},
+		{"12.3400", "BRL", 1234, nil}, // NUMERIC(24,4) rendering
+		{"0", "BRL", 0, nil},
+
+		// negative values
+		{"-0.5", "BRL", -50, nil},
+		{"-12.34", "BRL", -1234, nil},
+		{"-0", "BRL", 0, nil},
+		{"-12.345", "BRL", 0, ErrTooPrecise},
+
+		// too many fraction digits for the currency
+		{"12.345", "BRL", 0, ErrTooPrecise},
+		{"12.341", "USD", 0, ErrTooPrecise},
+		{"1.2345", "BHD", 0, ErrTooPrecise},
+		{"1.234", "BHD", 1234, nil},
+		{"1.2345", "CLF", 12345, nil},
+
+		// exponent-0 currencies
+		{"1500", "JPY", 1500, nil},
+		{"1500.000", "JPY", 1500, nil},
+		{"1500.5", "JPY", 0, ErrTooPrecise},
+		{"-7", "KRW", -7, nil},
+
+		// codes that are not a currency
+		{"1.00", "", 0, ErrInvalidCurrency},
+		{"1.00", "BR", 0, ErrInvalidCurrency},
+		{"1.00", "BRLX", 0, ErrInvalidCurrency},
+		{"1.00", "B1L", 0, ErrInvalidCurrency},
+		{"1.00", "R$", 0, ErrInvalidCurrency},
+
+		// leading/trailing garbage and other malformed input
+		{"", "BRL", 0, ErrInvalidAmount},
+		{"-", "BRL", 0, ErrInvalidAmount},
+		{"--1", "BRL", 0, ErrInvalidAmount},
+		{"+-1", "BRL", 0, ErrInvalidAmount},
+		{"12.34abc", "BRL", 0, ErrInvalidAmount},
+		{"abc12.34", "BRL", 0, ErrInvalidAmount},
+		{"$12.34", "BRL", 0, ErrInvalidAmount},
+		{"12.34 BRL", "BRL", 0, ErrInvalidAmount},
+		{"12,34", "BRL", 0, ErrInvalidAmount},
+		{"1 000", "BRL", 0, ErrInvalidAmount},
+		{"1e3", "BRL", 0, ErrInvalidAmount},
+		{"0x10", "BRL", 0, ErrInvalidAmount},
+		{".5", "BRL", 0, ErrInvalidAmount},
+		{"5.", "BRL", 0, ErrInvalidAmount},
+		{"1.2.3", "BRL", 0, ErrInvalidAmount},
+		{"NaN", "BRL", 0, ErrInvalidAmount},
+
+		// range
+		{"92233720368547758.07", "BRL", math.MaxInt64, nil},
+		{"92233720368547758.08", "BRL", 0, ErrOverflow},
+		{"99999999999999999999", "JPY", 0, ErrOverflow},
+	}
+	for _, tc := range tests {
+		m, err := Parse(tc.in, tc.currency)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("Parse(%q, %q): got error %v, want %v", tc.in, tc.currency, err, tc.err)
+			continue
+		}
+		if err == nil && m.Minor() != tc.minor {
+			t.Errorf("Parse(%q, %q) = %d minor units, want %d", tc.in, tc.currency, m.Minor(), tc.minor)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	brl := func(minor int64) Money { return Money{minor: minor, currency: "BRL"} }
+	tests := []struct {
+		name string
+		a, b Money
+		want Money
+		err  error
+	}{
+		{"sum", brl(1234), brl(66), brl(1300), nil},
+		{"negative", brl(100), brl(-250), brl(-150), nil},
+		{"zero value adopts currency", Money{}, brl(5), brl(5), nil},
+		{"currency mismatch", brl(1), Money{minor: 1, currency: "USD"}, Money{}, ErrCurrencyMismatch},
+		{"max", brl(math.MaxInt64 - 1), brl(1), brl(math.MaxInt64), nil},
+		{"overflow", brl(math.MaxInt64), brl(1), Money{}, ErrOverflow},
+		{"overflow of two large amounts", brl(math.MaxInt64 / 2), brl(math.MaxInt64/2 + 2), Money{}, ErrOverflow},
+		{"min", brl(math.MinInt64 + 1), brl(-1), brl(math.MinInt64), nil},
+		{"underflow", brl(math.MinInt64), brl(-1), Money{}, ErrOverflow},
+	}
+	for _, tc := range tests {
+		got, err := tc.a.Add(tc.b)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		minor    int64
+		currency string
+		want     string
+	}{
+		{1234, "BRL", "12.34"},
+		{5, "BRL", "0.05"},
+		{0, "BRL", "0.00"},
+		{-50, "BRL", "-0.50"},
+		{-1, "USD", "-0.01"},
+		{1500, "JPY", "1500"},
+		{-7, "KRW", "-7"},
+		{1, "BHD", "0.001"},
+		{12345, "CLF", "1.2345"},
+		{math.MaxInt64, "BRL", "92233720368547758.07"},
+		{math.MinInt64 + 1, "BRL", "-92233720368547758.07"},
+	}
+	for _, tc := range tests {
+		m := Money{minor: tc.minor, currency: tc.currency}
+		s := m.String()
+		if s != tc.want {
+			t.Errorf("String(%d %s) = %q, want %q", tc.minor, tc.currency, s, tc.want)
+		}
+		back, err := Parse(s, tc.currency)
+		if err != nil || back != m {
+			t.Errorf("Parse(String(%d %s)) = %+v, %v; want the same amount", tc.minor, tc.currency, back, err)
+		}
+	}
+	if s := (Money{minor: math.MinInt64, currency: "BRL"}).String(); s != "-92233720368547758.08" {
+		t.Errorf("String(MinInt64 BRL) = %q, want -92233720368547758.08", s)
+	}
+}
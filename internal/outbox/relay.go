@@ -0,0 +1,155 @@
+// Package outbox relays events written to the transactional outbox table
+// to Kafka with at-least-once delivery.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/config"
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/AgentTarik/finance-api/telemetry"
+	"go.uber.org/zap"
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, key string, v any) error
+}
+
+type Relay struct {
+	log              *zap.Logger
+	repo             storage.OutboxRepo
+	pub              Publisher
+	interval         time.Duration
+	batchSize        int
+	lease            time.Duration
+	publishTimeout   time.Duration
+	maxAttempts      int
+	retryBaseBackoff time.Duration
+	retryMaxBackoff  time.Duration
+}
+
+func NewRelay(log *zap.Logger, repo storage.OutboxRepo, pub Publisher, cfg config.Relay) *Relay {
+	return &Relay{
+		log:              log,
+		repo:             repo,
+		pub:              pub,
+		interval:         cfg.Interval,
+		batchSize:        cfg.BatchSize,
+		lease:            cfg.Lease,
+		publishTimeout:   cfg.PublishTimeout,
+		maxAttempts:      cfg.MaxAttempts,
+		retryBaseBackoff: cfg.RetryBaseBackoff,
+		retryMaxBackoff:  cfg.RetryMaxBackoff,
+	}
+}
+
+// Run drains the outbox until ctx is cancelled. A message is marked
+// dispatched only after Kafka acknowledged it, so a crash in between
+// re-sends it once its lease expires (consumers dedupe by key).
+func (r *Relay) Run(ctx context.Context) {
+	r.log.Info("outbox relay started")
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		// keep draining while full batches come back
+		for ctx.Err() == nil {
+			if r.dispatchBatch(ctx) < r.batchSize {
+				break
+			}
+		}
+		r.updateStats(ctx)
+
+		select {
+		case <-ctx.Done():
+			r.log.Info("outbox relay stopped")
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// dispatchBatch publishes one batch and returns how many messages it claimed.
+func (r *Relay) dispatchBatch(ctx context.Context) int {
+	msgs, err := r.repo.ClaimOutbox(ctx, r.batchSize, r.lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.log.Error("outbox claim failed", zap.Error(err))
+		}
+		return 0
+	}
+	for _, m := range msgs {
+		ctxPub, cancel := context.WithTimeout(ctx, r.publishTimeout)
+		err := r.pub.Publish(ctxPub, m.AggregateID.String(), m.Payload)
+		cancel()
+
+		if err != nil {
+			telemetry.IncOutboxFailed()
+			if m.Attempts >= r.maxAttempts {
+				r.deadLetter(ctx, m, err)
+				continue
+			}
+			retryAt := time.Now().Add(r.backoff(m.Attempts))
+			r.log.Warn("outbox publish failed; will retry",
+				zap.Error(err),
+				zap.Int64("outbox_id", m.ID),
+				zap.Int("attempt", m.Attempts),
+				zap.Time("retry_at", retryAt))
+			if err := r.repo.MarkOutboxFailed(ctx, m.ID, err.Error(), retryAt); err != nil {
+				r.log.Error("outbox mark failed", zap.Error(err), zap.Int64("outbox_id", m.ID))
+			}
+			continue
+		}
+
+		if err := r.repo.MarkOutboxDispatched(ctx, m.ID); err != nil {
+			// published but not marked: it will be sent again after the lease
+			r.log.Error("outbox mark dispatched failed", zap.Error(err), zap.Int64("outbox_id", m.ID))
+			continue
+		}
+		telemetry.IncOutboxDispatched()
+		telemetry.ObserveOutboxLag(time.Since(m.CreatedAt))
+		r.log.Info("kafka published",
+			zap.Int64("outbox_id", m.ID),
+			zap.String("key", m.AggregateID.String()),
+			zap.String("event_type", m.EventType))
+	}
+	return len(msgs)
+}
+
+// deadLetter moves a message that exhausted its attempts to the DLQ.
+func (r *Relay) deadLetter(ctx context.Context, m storage.OutboxMessage, cause error) {
+	if err := r.repo.DeadLetterOutbox(ctx, m.ID, cause.Error()); err != nil {
+		r.log.Error("outbox dead-letter failed", zap.Error(err), zap.Int64("outbox_id", m.ID))
+		return
+	}
+	telemetry.IncDeadLetters(storage.DeadLetterPublish)
+	r.log.Error("kafka publish failed permanently; moved to DLQ",
+		zap.Error(cause),
+		zap.Int64("outbox_id", m.ID),
+		zap.Int("attempts", m.Attempts),
+		zap.String("key", m.AggregateID.String()))
+}
+
+// backoff grows exponentially with the attempt count, capped at retryMaxBackoff.
+func (r *Relay) backoff(attempt int) time.Duration {
+	d := r.retryBaseBackoff
+	for i := 1; i < attempt && d < r.retryMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.retryMaxBackoff {
+		d = r.retryMaxBackoff
+	}
+	return d
+}
+
+func (r *Relay) updateStats(ctx context.Context) {
+	s, err := r.repo.OutboxStats(ctx)
+	if err != nil {
+		return
+	}
+	var age time.Duration
+	if !s.OldestPending.IsZero() {
+		age = time.Since(s.OldestPending)
+	}
+	telemetry.SetOutboxPending(s.Pending, age)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrActionTokenUsed = errors.New("token already used or expired")
+
+// ActionToken is an issued email verification or password reset token,
+// identified by its jti.
+type ActionToken struct {
+	ID        string
+	UserID    uuid.UUID
+	Purpose   string
+	ExpiresAt time.Time
+}
+
+type AccountRepo interface {
+	CreateActionToken(ctx context.Context, t ActionToken) error
+	// UseActionToken spends the token id issued for purpose and returns its
+	// user. Other unused tokens of that user and purpose are spent with it,
+	// so only the latest link mailed matters until one is used.
+	UseActionToken(ctx context.Context, id, purpose string) (uuid.UUID, error)
+	MarkEmailVerified(ctx context.Context, userID uuid.UUID) error
+	EmailVerified(ctx context.Context, userID uuid.UUID) (bool, error)
+	SetPasswordHash(ctx context.Context, userID uuid.UUID, hash string) error
+}
+
+func (p *PostgresStore) CreateActionToken(ctx context.Context, t ActionToken) error {
+	_, err := p.DB.ExecContext(ctx, `
+		INSERT INTO action_tokens (id, user_id, purpose, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, t.ID, t.UserID, t.Purpose, t.ExpiresAt)
+	return err
+}
+
+func (p *PostgresStore) UseActionToken(ctx context.Context, id, purpose string) (uuid.UUID, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	err = tx.QueryRowContext(ctx, `
+		UPDATE action_tokens SET used_at = NOW()
+		WHERE id = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, id, purpose).Scan(&userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return uuid.Nil, ErrActionTokenUsed
+	case err != nil:
+		return uuid.Nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE action_tokens SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`, userID, purpose); err != nil {
+		return uuid.Nil, err
+	}
+	return userID, tx.Commit()
+}
+
+func (p *PostgresStore) MarkEmailVerified(ctx context.Context, userID uuid.UUID) error {
+	_, err := p.DB.ExecContext(ctx, `
+		UPDATE users SET email_verified_at = NOW()
+		WHERE id = $1 AND email_verified_at IS NULL
+	`, userID)
+	return err
+}
+
+func (p *PostgresStore) EmailVerified(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var verified bool
+	err := p.DB.QueryRowContext(ctx, `
+		SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1
+	`, userID).Scan(&verified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrUserNotFound
+	}
+	return verified, err
+}
+
+func (p *PostgresStore) SetPasswordHash(ctx context.Context, userID uuid.UUID, hash string) error {
+	res, err := p.DB.ExecContext(ctx, `
+		UPDATE users SET password_hash = $2 WHERE id = $1
+	`, userID, hash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyInvalid  = errors.New("api key invalid, expired or revoked")
+)
+
+// APIKey is a user's API key. The key itself is shown once, on creation;
+// only its hash is stored.
+type APIKey struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	ExpiresAt  *time.Time // nil: never
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// APIKeyOwner is a key presented on a request plus its owner's current
+// role and granted scopes.
+type APIKeyOwner struct {
+	Key        APIKey
+	Role       string
+	UserScopes []string
+}
+
+type APIKeyRepo interface {
+	CreateAPIKey(ctx context.Context, k APIKey) error
+	// ListAPIKeys returns the user's keys that are not revoked, newest first.
+	ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]APIKey, error)
+	GetAPIKey(ctx context.Context, userID, id uuid.UUID) (APIKey, error)
+	UpdateAPIKey(ctx context.Context, k APIKey) error
+	RevokeAPIKey(ctx context.Context, userID, id uuid.UUID) error
+	// UseAPIKey resolves a usable key by hash and records its use; unknown,
+	// expired or revoked keys give ErrAPIKeyInvalid.
+	UseAPIKey(ctx context.Context, hash string) (APIKeyOwner, error)
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at`
+
+// scanAPIKey reads apiKeyColumns followed by the extra destinations.
+func scanAPIKey(r rowScanner, extra ...any) (APIKey, error) {
+	var (
+		k               APIKey
+		scopes          string
+		expires, usedAt sql.NullTime
+	)
+	dest := append([]any{&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.KeyHash, &scopes, &expires, &usedAt, &k.CreatedAt}, extra...)
+	if err := r.Scan(dest...); err != nil {
+		return APIKey{}, err
+	}
+	k.Scopes = strings.Fields(scopes)
+	if expires.Valid {
+		k.ExpiresAt = &expires.Time
+	}
+	if usedAt.Valid {
+		k.LastUsedAt = &usedAt.Time
+	}
+	return k, nil
+}
+
+func (p *PostgresStore) CreateAPIKey(ctx context.Context, k APIKey) error {
+	_, err := p.DB.ExecContext(ctx, `
+		INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, k.ID, k.UserID, k.Name, k.Prefix, k.KeyHash, strings.Join(k.Scopes, " "), k.ExpiresAt)
+	return err
+}
+
+func (p *PostgresStore) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]APIKey, error) {
+	rows, err := p.DB.QueryContext(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+func (p *PostgresStore) GetAPIKey(ctx context.Context, userID, id uuid.UUID) (APIKey, error) {
+	k, err := scanAPIKey(p.DB.QueryRowContext(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return k, err
+}
+
+func (p *PostgresStore) UpdateAPIKey(ctx context.Context, k APIKey) error {
+	res, err := p.DB.ExecContext(ctx, `
+		UPDATE api_keys SET name = $3, scopes = $4, expires_at = $5
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, k.ID, k.UserID, k.Name, strings.Join(k.Scopes, " "), k.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) RevokeAPIKey(ctx context.Context, userID, id uuid.UUID) error {
+	res, err := p.DB.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) UseAPIKey(ctx context.Context, hash string) (APIKeyOwner, error) {
+	var (
+		o          APIKeyOwner
+		userScopes string
+	)
+	k, err := scanAPIKey(p.DB.QueryRowContext(ctx, `
+		WITH k AS (
+			UPDATE api_keys SET last_used_at = NOW()
+			WHERE key_hash = $1 AND revoked_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > NOW())
+			  AND user_id IN (SELECT id FROM users WHERE deactivated_at IS NULL)
+			RETURNING `+apiKeyColumns+`
+		)
+		SELECT k.*, u.role, u.scopes
+		FROM k JOIN users u ON u.id = k.user_id
+	`, hash), &o.Role, &userScopes)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return APIKeyOwner{}, ErrAPIKeyInvalid
+	case err != nil:
+		return APIKeyOwner{}, err
+	}
+	o.Key = k
+	o.UserScopes = strings.Fields(userScopes)
+	return o, nil
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	ErrDeadLetterResolved = errors.New("dead letter already resolved")
+)
+
+// DeadLetter sources.
+const (
+	DeadLetterSchema  = "schema"  // rejected by the event schema validator
+	DeadLetterPublish = "publish" // Kafka publishing failed permanently
+)
+
+// DeadLetter statuses.
+const (
+	DeadLetterOpen      = "open"
+	DeadLetterReplayed  = "replayed"
+	DeadLetterDiscarded = "discarded"
+)
+
+type DeadLetter struct {
+	ID          uuid.UUID
+	Source      string
+	AggregateID uuid.UUID
+	EventType   string
+	Payload     json.RawMessage
+	Reason      string
+	Attempts    int
+	Status      string
+	CreatedAt   time.Time
+	ResolvedAt  *time.Time
+}
+
+type DeadLetterRepo interface {
+	AddDeadLetter(ctx context.Context, d DeadLetter) error
+	// ListDeadLetters returns newest first; empty status means any.
+	ListDeadLetters(ctx context.Context, status string, limit int) ([]DeadLetter, error)
+	GetDeadLetter(ctx context.Context, id uuid.UUID) (DeadLetter, error)
+	// ReplayDeadLetter puts the payload back into the outbox and marks the
+	// entry replayed, atomically.
+	ReplayDeadLetter(ctx context.Context, id uuid.UUID) error
+	DiscardDeadLetter(ctx context.Context, id uuid.UUID) error
+}
+
+func (p *PostgresStore) AddDeadLetter(ctx context.Context, d DeadLetter) error {
+	return insertDeadLetter(ctx, p.DB, d)
+}
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertDeadLetter writes d on the pool or inside a caller's DB transaction.
+func insertDeadLetter(ctx context.Context, db execer, d DeadLetter) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO dead_letters (id, source, aggregate_id, event_type, payload, reason, attempts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, d.ID, d.Source, d.AggregateID, d.EventType, []byte(d.Payload), d.Reason, d.Attempts)
+	return err
+}
+
+// DeadLetterOutbox moves an outbox message to the DLQ in one DB transaction.
+func (p *PostgresStore) DeadLetterOutbox(ctx context.Context, outboxID int64, reason string) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO dead_letters (id, source, aggregate_id, event_type, payload, reason, attempts)
+		SELECT $2, $3, aggregate_id, event_type, payload, $4, attempts
+		FROM outbox
+		WHERE id = $1 AND status = 'pending'
+	`, outboxID, uuid.New(), DeadLetterPublish, reason); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE outbox SET status = 'dead', last_error = $2 WHERE id = $1 AND status = 'pending'
+	`, outboxID, reason); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const deadLetterColumns = `id, source, aggregate_id, event_type, payload, reason, attempts, status, created_at, resolved_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDeadLetter(r rowScanner) (DeadLetter, error) {
+	var (
+		d        DeadLetter
+		payload  []byte
+		resolved sql.NullTime
+	)
+	if err := r.Scan(&d.ID, &d.Source, &d.AggregateID, &d.EventType, &payload, &d.Reason, &d.Attempts, &d.Status, &d.CreatedAt, &resolved); err != nil {
+		return DeadLetter{}, err
+	}
+	d.Payload = payload
+	if resolved.Valid {
+		d.ResolvedAt = &resolved.Time
+	}
+	return d, nil
+}
+
+func (p *PostgresStore) ListDeadLetters(ctx context.Context, status string, limit int) ([]DeadLetter, error) {
+	rows, err := p.DB.QueryContext(ctx, `
+		SELECT `+deadLetterColumns+`
+		FROM dead_letters
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []DeadLetter{}
+	for rows.Next() {
+		d, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (p *PostgresStore) GetDeadLetter(ctx context.Context, id uuid.UUID) (DeadLetter, error) {
+	d, err := scanDeadLetter(p.DB.QueryRowContext(ctx, `
+		SELECT `+deadLetterColumns+` FROM dead_letters WHERE id = $1
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	return d, err
+}
+
+func (p *PostgresStore) ReplayDeadLetter(ctx context.Context, id uuid.UUID) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := resolveDeadLetter(ctx, tx, id, DeadLetterReplayed); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO outbox (aggregate_id, event_type, payload)
+		SELECT aggregate_id, event_type, payload FROM dead_letters WHERE id = $1
+	`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) DiscardDeadLetter(ctx context.Context, id uuid.UUID) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := resolveDeadLetter(ctx, tx, id, DeadLetterDiscarded); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// resolveDeadLetter moves an open entry to status, reporting why it could not.
+func resolveDeadLetter(ctx context.Context, tx *sql.Tx, id uuid.UUID, status string) error {
+	var current string
+	err := tx.QueryRowContext(ctx, `SELECT status FROM dead_letters WHERE id = $1 FOR UPDATE`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if current != DeadLetterOpen {
+		return ErrDeadLetterResolved
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE dead_letters SET status = $2, resolved_at = NOW() WHERE id = $1
+	`, id, status)
+	return err
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress")
+	ErrIdempotencyMismatch   = errors.New("idempotency key was used with a different request")
+)
+
+// Cutoffs are computed by the database, against the same clock that set
+// created_at.
+const (
+	// idempotencyTTL is how long keys (and their responses) are remembered.
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyLockTimeout releases keys whose first request never finished.
+	idempotencyLockTimeout = time.Minute
+)
+
+// IdempotentResponse is the stored outcome of the first request with a key.
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+type IdempotencyRepo interface {
+	// BeginIdempotency reserves (userID, key) for a request fingerprint.
+	// It returns (nil, nil) when the caller should process the request, the
+	// stored response when it already completed, ErrIdempotencyMismatch for
+	// a different fingerprint and ErrIdempotencyInProgress while the first
+	// request is still running.
+	BeginIdempotency(ctx context.Context, userID uuid.UUID, key, fingerprint string) (*IdempotentResponse, error)
+	CompleteIdempotency(ctx context.Context, userID uuid.UUID, key string, resp IdempotentResponse) error
+	// ReleaseIdempotency forgets a key so the request can be retried.
+	ReleaseIdempotency(ctx context.Context, userID uuid.UUID, key string) error
+	// PurgeIdempotency deletes every expired key and returns how many.
+	PurgeIdempotency(ctx context.Context) (int64, error)
+}
+
+func (p *PostgresStore) BeginIdempotency(ctx context.Context, userID uuid.UUID, key, fingerprint string) (*IdempotentResponse, error) {
+	// expired keys behave as if they were never used
+	if _, err := p.DB.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND created_at < NOW() - $3 * INTERVAL '1 millisecond'
+	`, userID, key, idempotencyTTL.Milliseconds()); err != nil {
+		return nil, err
+	}
+
+	res, err := p.DB.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, key, fingerprint)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, key) DO NOTHING
+	`, userID, key, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil, nil
+	}
+
+	var (
+		storedFP  string
+		status    sql.NullInt64
+		body      []byte
+		createdAt time.Time
+	)
+	err = p.DB.QueryRowContext(ctx, `
+		SELECT fingerprint, status_code, response, created_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`, userID, key).Scan(&storedFP, &status, &body, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// deleted concurrently; let the client retry
+		return nil, ErrIdempotencyInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	if storedFP != fingerprint {
+		return nil, ErrIdempotencyMismatch
+	}
+	if status.Valid {
+		return &IdempotentResponse{StatusCode: int(status.Int64), Body: body}, nil
+	}
+
+	// the first request died without completing: take the key over
+	res, err = p.DB.ExecContext(ctx, `
+		UPDATE idempotency_keys SET created_at = NOW()
+		WHERE user_id = $1 AND key = $2 AND status_code IS NULL AND created_at = $3
+		  AND created_at < NOW() - $4 * INTERVAL '1 millisecond'
+	`, userID, key, createdAt, idempotencyLockTimeout.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil, nil
+	}
+	return nil, ErrIdempotencyInProgress
+}
+
+func (p *PostgresStore) CompleteIdempotency(ctx context.Context, userID uuid.UUID, key string, resp IdempotentResponse) error {
+	_, err := p.DB.ExecContext(ctx, `
+		UPDATE idempotency_keys SET status_code = $3, response = $4
+		WHERE user_id = $1 AND key = $2
+	`, userID, key, resp.StatusCode, resp.Body)
+	return err
+}
+
+func (p *PostgresStore) ReleaseIdempotency(ctx context.Context, userID uuid.UUID, key string) error {
+	_, err := p.DB.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND status_code IS NULL
+	`, userID, key)
+	return err
+}
+
+func (p *PostgresStore) PurgeIdempotency(ctx context.Context) (int64, error) {
+	res, err := p.DB.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE created_at < NOW() - $1 * INTERVAL '1 millisecond'
+	`, idempotencyTTL.Milliseconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
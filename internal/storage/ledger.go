@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/ledger"
+	"github.com/AgentTarik/finance-api/internal/money"
+	"github.com/google/uuid"
+)
+
+// Balance is a user's balance in one currency.
+type Balance struct {
+	UserID    uuid.UUID
+	Amount    money.Money
+	UpdatedAt time.Time
+}
+
+type LedgerRepo interface {
+	// PostTx applies a status change, posts its journal entry, writes events
+	// to the outbox and rejected events to the dead-letter queue in a single
+	// DB transaction. An entry of the same kind is never posted twice for a
+	// transaction; events and dead letters are only written with the first.
+	PostTx(ctx context.Context, ch StatusChange, e ledger.Entry, events []OutboxMessage, deadLetters []DeadLetter) error
+	// AccountBalance derives an account's balance from its postings.
+	AccountBalance(ctx context.Context, code string) (money.Money, error)
+}
+
+type BalanceRepo interface {
+	// UserBalances returns the materialized current balances of a user.
+	UserBalances(ctx context.Context, userID uuid.UUID) ([]Balance, error)
+	// UserBalancesAt derives a user's balances from postings made up to at.
+	UserBalancesAt(ctx context.Context, userID uuid.UUID, at time.Time) ([]Balance, error)
+}
+
+func (p *PostgresStore) PostTx(ctx context.Context, ch StatusChange, e ledger.Entry, events []OutboxMessage, deadLetters []DeadLetter) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO ledger_entries (id, transaction_id, kind, description, posted_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (transaction_id, kind) DO NOTHING
+	`, e.ID, e.TransactionID, string(e.Kind), e.Description, e.PostedAt)
+	if err != nil {
+		return err
+	}
+	// already posted (e.g. reprocessing): keep the original entry and events
+	n, _ := res.RowsAffected()
+	posted := n == 1
+	if posted {
+		for _, ps := range e.Postings {
+			accID, err := ensureAccount(ctx, tx, ps.Account)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO ledger_postings (entry_id, account_id, amount, currency)
+				VALUES ($1, $2, $3::numeric, $4)
+			`, e.ID, accID, ps.Amount.String(), ps.Amount.Currency()); err != nil {
+				return err
+			}
+			if ps.Account.UserID != nil {
+				delta := ledger.Balance(ps.Account.Type, ps.Amount)
+				if err := applyBalance(ctx, tx, *ps.Account.UserID, delta, e.PostedAt); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := applyStatusChange(ctx, tx, ch); err != nil {
+		return err
+	}
+	if posted {
+		if err := insertOutbox(ctx, tx, events); err != nil {
+			return err
+		}
+		for _, d := range deadLetters {
+			if err := insertDeadLetter(ctx, tx, d); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// ensureAccount returns the id of the account with a.Code, creating it if
+// needed. Existing accounts are only read: the shared settlement accounts
+// are hit by every posting, and a write (even a no-op ON CONFLICT update)
+// would lock their row until commit and serialize the worker shards.
+func ensureAccount(ctx context.Context, tx *sql.Tx, a ledger.Account) (string, error) {
+	const lookup = `SELECT id FROM ledger_accounts WHERE code = $1`
+	var id string
+	err := tx.QueryRowContext(ctx, lookup, a.Code).Scan(&id)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return id, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO ledger_accounts (id, code, type, currency, user_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (code) DO NOTHING
+	`, a.ID, a.Code, string(a.Type), a.Currency, a.UserID); err != nil {
+		return "", err
+	}
+	// either ours or the one a concurrent posting just committed
+	err = tx.QueryRowContext(ctx, lookup, a.Code).Scan(&id)
+	return id, err
+}
+
+// applyBalance adds delta to the user's materialized balance.
+func applyBalance(ctx context.Context, tx *sql.Tx, userID uuid.UUID, delta money.Money, at time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO account_balances (user_id, currency, balance, updated_at)
+		VALUES ($1, $2, $3::numeric, $4)
+		ON CONFLICT (user_id, currency) DO UPDATE
+		SET balance    = account_balances.balance + EXCLUDED.balance,
+		    updated_at = GREATEST(account_balances.updated_at, EXCLUDED.updated_at)
+	`, userID, delta.Currency(), delta.String(), at)
+	return err
+}
+
+func (p *PostgresStore) AccountBalance(ctx context.Context, code string) (money.Money, error) {
+	var typ, currency, sum string
+	err := p.DB.QueryRowContext(ctx, `
+		SELECT a.type, a.currency, COALESCE(SUM(p.amount), 0)::text
+		FROM ledger_accounts a
+		LEFT JOIN ledger_postings p ON p.account_id = a.id
+		WHERE a.code = $1
+		GROUP BY a.id
+	`, code).Scan(&typ, &currency, &sum)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return money.Money{}, ledger.ErrAccountNotFound
+		}
+		return money.Money{}, err
+	}
+	m, err := money.Parse(sum, currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return ledger.Balance(ledger.AccountType(typ), m), nil
+}
+
+func (p *PostgresStore) UserBalances(ctx context.Context, userID uuid.UUID) ([]Balance, error) {
+	rows, err := p.DB.QueryContext(ctx, `
+		SELECT currency, balance::text, updated_at
+		FROM account_balances
+		WHERE user_id = $1
+		ORDER BY currency
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanBalances(rows, userID)
+}
+
+func (p *PostgresStore) UserBalancesAt(ctx context.Context, userID uuid.UUID, at time.Time) ([]Balance, error) {
+	rows, err := p.DB.QueryContext(ctx, `
+		SELECT a.currency,
+		       SUM(CASE WHEN a.type IN ('asset', 'expense') THEN p.amount ELSE -p.amount END)::text,
+		       MAX(e.posted_at)
+		FROM ledger_postings p
+		JOIN ledger_accounts a ON a.id = p.account_id
+		JOIN ledger_entries e  ON e.id = p.entry_id
+		WHERE a.user_id = $1 AND e.posted_at <= $2
+		GROUP BY a.currency
+		ORDER BY a.currency
+	`, userID, at)
+	if err != nil {
+		return nil, err
+	}
+	return scanBalances(rows, userID)
+}
+
+func scanBalances(rows *sql.Rows, userID uuid.UUID) ([]Balance, error) {
+	defer rows.Close()
+	out := []Balance{}
+	for rows.Next() {
+		var (
+			b                Balance
+			currency, amount string
+		)
+		if err := rows.Scan(&currency, &amount, &b.UpdatedAt); err != nil {
+			return nil, err
+		}
+		m, err := money.Parse(amount, currency)
+		if err != nil {
+			return nil, err
+		}
+		b.UserID, b.Amount = userID, m
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
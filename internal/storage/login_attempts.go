@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Login throttle kinds: failures are counted per email and per client IP.
+const (
+	LoginByEmail = "email"
+	LoginByIP    = "ip"
+)
+
+// LoginThrottle is the failed-login state of one email or IP.
+type LoginThrottle struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// LoginAudit is one login attempt.
+type LoginAudit struct {
+	Email   string
+	IP      string
+	UserID  *uuid.UUID
+	Success bool
+	Reason  string // why it failed (invalid_credentials | throttled | locked)
+}
+
+type LoginAttemptRepo interface {
+	// LoginThrottle returns the state of (kind, key); the zero value when
+	// there were no failures.
+	LoginThrottle(ctx context.Context, kind, key string) (LoginThrottle, error)
+	// RecordLoginFailure counts a failure and returns the new count. Counts
+	// older than resetAfter start over.
+	RecordLoginFailure(ctx context.Context, kind, key string, resetAfter time.Duration) (int, error)
+	LockLogin(ctx context.Context, kind, key string, until time.Time) error
+	// ClearLoginFailures forgets failures and any lock (success, admin unlock).
+	ClearLoginFailures(ctx context.Context, kind, key string) error
+	AddLoginAudit(ctx context.Context, a LoginAudit) error
+}
+
+func (p *PostgresStore) LoginThrottle(ctx context.Context, kind, key string) (LoginThrottle, error) {
+	var (
+		t      LoginThrottle
+		locked sql.NullTime
+	)
+	err := p.DB.QueryRowContext(ctx, `
+		SELECT failures, last_failure_at, locked_until
+		FROM login_throttle
+		WHERE kind = $1 AND key = $2
+	`, kind, key).Scan(&t.Failures, &t.LastFailureAt, &locked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return LoginThrottle{}, nil
+	}
+	if err != nil {
+		return LoginThrottle{}, err
+	}
+	if locked.Valid {
+		t.LockedUntil = &locked.Time
+	}
+	return t, nil
+}
+
+func (p *PostgresStore) RecordLoginFailure(ctx context.Context, kind, key string, resetAfter time.Duration) (int, error) {
+	var n int
+	err := p.DB.QueryRowContext(ctx, `
+		INSERT INTO login_throttle (kind, key, failures, last_failure_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (kind, key) DO UPDATE
+		SET failures = CASE
+		        WHEN login_throttle.last_failure_at < NOW() - make_interval(secs => $3) THEN 1
+		        ELSE login_throttle.failures + 1
+		    END,
+		    last_failure_at = NOW()
+		RETURNING failures
+	`, kind, key, resetAfter.Seconds()).Scan(&n)
+	return n, err
+}
+
+func (p *PostgresStore) LockLogin(ctx context.Context, kind, key string, until time.Time) error {
+	_, err := p.DB.ExecContext(ctx, `
+		UPDATE login_throttle SET locked_until = $3
+		WHERE kind = $1 AND key = $2
+	`, kind, key, until)
+	return err
+}
+
+func (p *PostgresStore) ClearLoginFailures(ctx context.Context, kind, key string) error {
+	_, err := p.DB.ExecContext(ctx, `
+		DELETE FROM login_throttle WHERE kind = $1 AND key = $2
+	`, kind, key)
+	return err
+}
+
+func (p *PostgresStore) AddLoginAudit(ctx context.Context, a LoginAudit) error {
+	_, err := p.DB.ExecContext(ctx, `
+		INSERT INTO login_audit (email, ip, user_id, success, reason)
+		VALUES ($1, $2, $3, $4, $5)
+	`, a.Email, a.IP, a.UserID, a.Success, a.Reason)
+	return err
+}
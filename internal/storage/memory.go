@@ -1,84 +1,312 @@
 package storage
 
 import (
+	"context"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/AgentTarik/finance-api/internal/money"
 	"github.com/google/uuid"
 )
 
+type User struct {
+	ID            uuid.UUID
+	Name          string
+	Email         string
+	EmailVerified bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeactivatedAt *time.Time // set once the account is deactivated
+}
 
+// NewUser is a user to create. A zero ID is replaced by a server-generated
+// UUIDv7 (time-ordered, so new rows land at the end of the index); an empty
+// Role means "user".
+type NewUser struct {
+	ID           uuid.UUID
+	Name         string
+	Email        string
+	PasswordHash string
+	Role         string
+}
 
-type User struct {
-	ID   uuid.UUID
-	Name string
+func (n NewUser) idOrNew() (uuid.UUID, error) {
+	if n.ID != uuid.Nil {
+		return n.ID, nil
+	}
+	return uuid.NewV7()
+}
+
+func (n NewUser) roleOrDefault() string {
+	if n.Role == "" {
+		return "user"
+	}
+	return n.Role
+}
+
+// UserUpdate holds the profile fields to change; nil fields are kept.
+// Changing the email marks it unverified again.
+type UserUpdate struct {
+	Name  *string
+	Email *string
 }
 
 type Transaction struct {
 	TransactionID uuid.UUID
 	UserID        uuid.UUID
-	Amount        float64
+	Amount        money.Money
 	Timestamp     time.Time
+	Category      string // optional, "" when uncategorized
 	Status        string
+	Attempts      int       // processing attempts (durable queue)
+	QueuedAt      time.Time // when the row entered the queue
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	ProcessedAt   *time.Time
+	LastError     string // last processing error, if any
 }
 
+// UserRepo is the one contract for users and their credentials, shared by
+// MemoryStore and PostgresStore (see storagetest.UserRepo).
 type UserRepo interface {
-	CreateUser(User) error
-	GetUser(uuid.UUID) (User, error)
+	// CreateUser stores u and returns it with its ID and timestamps. A taken
+	// ID gives ErrUserAlreadyExists, a taken email ErrEmailTaken.
+	CreateUser(ctx context.Context, u NewUser) (User, error)
+	// GetUser returns an active user; deactivated ones are ErrUserNotFound.
+	GetUser(ctx context.Context, id uuid.UUID) (User, error)
+	// GetUserAuthByEmail and GetUserAuthByID return a user's credentials and
+	// permissions, deactivated users included (see UserAuth.Deactivated).
+	// Unknown users are ErrUserNotFound.
+	GetUserAuthByEmail(ctx context.Context, email string) (*UserAuth, error)
+	GetUserAuthByID(ctx context.Context, id uuid.UUID) (*UserAuth, error)
+	// UpdateUser applies upd to an active user and returns the result;
+	// ErrEmailTaken if the new email belongs to another account. Changing
+	// the email spends the user's unused action tokens in the same
+	// transaction, since they were mailed to the old address.
+	UpdateUser(ctx context.Context, id uuid.UUID, upd UserUpdate) (User, error)
+	// DeactivateUser soft-deletes a user: the row is kept, but the user can
+	// no longer log in and every outstanding token and API key stops working.
+	DeactivateUser(ctx context.Context, id uuid.UUID) error
 }
 
 type TxRepo interface {
-	UpsertTx(Transaction) error
-	ListTx() ([]Transaction, error)
+	// InsertTx creates t, returning ErrTxExists if the id is taken.
+	InsertTx(ctx context.Context, t Transaction) error
+	GetTx(ctx context.Context, id uuid.UUID) (Transaction, error)
+	// GetTxForUser is GetTx restricted to userID's transactions: others'
+	// are reported as ErrTxNotFound.
+	GetTxForUser(ctx context.Context, userID, id uuid.UUID) (Transaction, error)
+	// ListTxByUser lists one page of a user's transactions.
+	ListTxByUser(ctx context.Context, userID uuid.UUID, f TxFilter) (TxPage, error)
+	// ListAllTx lists one page of every user's transactions (admin use only).
+	ListAllTx(ctx context.Context, f TxFilter) (TxPage, error)
 }
 
 // MemoryStore implementa UserRepo e TxRepo
 type MemoryStore struct {
 	mu    sync.RWMutex
-	users map[uuid.UUID]User
+	users map[uuid.UUID]memUser
 	txs   map[uuid.UUID]Transaction
 }
 
+// memUser is a user plus the credentials MemoryStore keeps for it.
+type memUser struct {
+	User
+	PasswordHash string
+	Role         string
+}
+
+func (m memUser) auth() *UserAuth {
+	return &UserAuth{
+		ID:            m.ID,
+		Name:          m.Name,
+		Email:         m.Email,
+		PasswordHash:  m.PasswordHash,
+		Role:          m.Role,
+		EmailVerified: m.EmailVerified,
+		Deactivated:   m.DeactivatedAt != nil,
+	}
+}
+
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		users: make(map[uuid.UUID]User),
+		users: make(map[uuid.UUID]memUser),
 		txs:   make(map[uuid.UUID]Transaction),
 	}
 }
 
-func (s *MemoryStore) CreateUser(u User) error {
+// emailTaken reports whether another user has email; s.mu must be held.
+func (s *MemoryStore) emailTaken(email string, except uuid.UUID) bool {
+	for _, o := range s.users {
+		if o.ID != except && o.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) CreateUser(_ context.Context, nu NewUser) (User, error) {
+	id, err := nu.idOrNew()
+	if err != nil {
+		return User{}, err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.users[u.ID]; ok {
-		return ErrUserAlreadyExists
+	if _, ok := s.users[id]; ok {
+		return User{}, ErrUserAlreadyExists
 	}
-	s.users[u.ID] = u
-	return nil
+	if s.emailTaken(nu.Email, id) {
+		return User{}, ErrEmailTaken
+	}
+	now := time.Now()
+	m := memUser{
+		User:         User{ID: id, Name: nu.Name, Email: nu.Email, CreatedAt: now, UpdatedAt: now},
+		PasswordHash: nu.PasswordHash,
+		Role:         nu.roleOrDefault(),
+	}
+	s.users[id] = m
+	return m.User, nil
+}
+
+func (s *MemoryStore) GetUser(_ context.Context, id uuid.UUID) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok || u.DeactivatedAt != nil {
+		return User{}, ErrUserNotFound
+	}
+	return u.User, nil
+}
+
+func (s *MemoryStore) GetUserAuthByEmail(_ context.Context, email string) (*UserAuth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, u := range s.users {
+		if u.Email == email {
+			return u.auth(), nil
+		}
+	}
+	return nil, ErrUserNotFound
 }
 
-func (s *MemoryStore) GetUser(id uuid.UUID) (User, error) {
+func (s *MemoryStore) GetUserAuthByID(_ context.Context, id uuid.UUID) (*UserAuth, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	u, ok := s.users[id]
 	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return u.auth(), nil
+}
+
+func (s *MemoryStore) UpdateUser(_ context.Context, id uuid.UUID, upd UserUpdate) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok || u.DeactivatedAt != nil {
 		return User{}, ErrUserNotFound
 	}
-	return u, nil
+	if upd.Email != nil && *upd.Email != u.Email {
+		if s.emailTaken(*upd.Email, id) {
+			return User{}, ErrEmailTaken
+		}
+		u.Email, u.EmailVerified = *upd.Email, false
+	}
+	if upd.Name != nil {
+		u.Name = *upd.Name
+	}
+	u.UpdatedAt = time.Now()
+	s.users[id] = u
+	return u.User, nil
 }
 
-func (s *MemoryStore) UpsertTx(t Transaction) error {
+func (s *MemoryStore) DeactivateUser(_ context.Context, id uuid.UUID) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok || u.DeactivatedAt != nil {
+		return ErrUserNotFound
+	}
+	now := time.Now()
+	u.DeactivatedAt, u.UpdatedAt = &now, now
+	s.users[id] = u
+	return nil
+}
+
+func (s *MemoryStore) InsertTx(_ context.Context, t Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.txs[t.TransactionID]; ok {
+		return ErrTxExists
+	}
+	now := time.Now()
+	if t.QueuedAt.IsZero() {
+		t.QueuedAt = now
+	}
+	t.CreatedAt, t.UpdatedAt = now, now
 	s.txs[t.TransactionID] = t
 	return nil
 }
 
-func (s *MemoryStore) ListTx() ([]Transaction, error) {
+func (s *MemoryStore) GetTx(_ context.Context, id uuid.UUID) (Transaction, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	t, ok := s.txs[id]
+	if !ok {
+		return Transaction{}, ErrTxNotFound
+	}
+	return t, nil
+}
+
+func (s *MemoryStore) ListTxByUser(_ context.Context, userID uuid.UUID, f TxFilter) (TxPage, error) {
+	return s.listTx(&userID, f)
+}
+
+func (s *MemoryStore) ListAllTx(_ context.Context, f TxFilter) (TxPage, error) {
+	return s.listTx(nil, f)
+}
+
+// listTx mirrors PostgresStore.listTx: same filters, order and cursors.
+func (s *MemoryStore) listTx(userID *uuid.UUID, f TxFilter) (TxPage, error) {
+	f, cur, err := f.normalize()
+	if err != nil {
+		return TxPage{}, err
+	}
+	asc := f.Sort == SortOldest
+
+	s.mu.RLock()
 	out := make([]Transaction, 0, len(s.txs))
 	for _, t := range s.txs {
+		if userID != nil && t.UserID != *userID {
+			continue
+		}
+		if !f.match(t) {
+			continue
+		}
+		if cur != nil && !cur.precedes(t) {
+			continue
+		}
 		out = append(out, t)
 	}
-	return out, nil
+	s.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if asc {
+			return txBefore(out[i], out[j].Timestamp, out[j].TransactionID)
+		}
+		return txBefore(out[j], out[i].Timestamp, out[i].TransactionID)
+	})
+	if f.Limit > 0 && len(out) > f.Limit+1 {
+		out = out[:f.Limit+1]
+	}
+	return pageOf(out, f), nil
+}
+
+func (s *MemoryStore) GetTxForUser(ctx context.Context, userID, id uuid.UUID) (Transaction, error) {
+	t, err := s.GetTx(ctx, id)
+	if err == nil && t.UserID != userID {
+		return Transaction{}, ErrTxNotFound
+	}
+	return t, err
 }
@@ -0,0 +1,21 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/AgentTarik/finance-api/internal/storage/storagetest"
+)
+
+func TestMemoryStoreUserRepo(t *testing.T) {
+	if err := storagetest.UserRepo(context.Background(), storage.NewMemoryStore()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryStoreTxListing(t *testing.T) {
+	if err := storagetest.TxListing(context.Background(), storage.NewMemoryStore()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrTOTPNotEnrolled    = errors.New("two-factor authentication not enrolled")
+	ErrChallengeInvalid   = errors.New("login challenge invalid or expired")
+)
+
+// maxChallengeAttempts is how many codes one login challenge accepts.
+const maxChallengeAttempts = 5
+
+// TOTPState is a user's TOTP enrollment. Secret is set (but Enabled false)
+// between enrollment and the first verified code.
+type TOTPState struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+type MFARepo interface {
+	TOTP(ctx context.Context, userID uuid.UUID) (TOTPState, error)
+	// SetPendingTOTP stores a new, not yet enabled secret.
+	SetPendingTOTP(ctx context.Context, userID uuid.UUID, secret string) error
+	// EnableTOTP turns 2FA on after the first code (of time step step) was
+	// verified, replacing any recovery codes with recoveryHashes.
+	EnableTOTP(ctx context.Context, userID uuid.UUID, step int64, recoveryHashes []string) error
+	DisableTOTP(ctx context.Context, userID uuid.UUID) error
+	// UseTOTPStep records step as used; false means it (or a later one) was
+	// already used, i.e. the code is being replayed.
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+	// UseRecoveryCode spends a recovery code; false if unknown or spent.
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash string) (bool, error)
+
+	CreateChallenge(ctx context.Context, hash string, userID uuid.UUID, expiresAt time.Time) error
+	// AttemptChallenge counts an attempt on a challenge and returns its user;
+	// expired, used or exhausted challenges give ErrChallengeInvalid.
+	AttemptChallenge(ctx context.Context, hash string) (uuid.UUID, error)
+	ConsumeChallenge(ctx context.Context, hash string) error
+}
+
+func (p *PostgresStore) TOTP(ctx context.Context, userID uuid.UUID) (TOTPState, error) {
+	var (
+		st     TOTPState
+		secret sql.NullString
+	)
+	err := p.DB.QueryRowContext(ctx, `
+		SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = $1
+	`, userID).Scan(&secret, &st.Enabled, &st.LastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TOTPState{}, ErrUserNotFound
+	}
+	st.Secret = secret.String
+	return st, err
+}
+
+func (p *PostgresStore) SetPendingTOTP(ctx context.Context, userID uuid.UUID, secret string) error {
+	res, err := p.DB.ExecContext(ctx, `
+		UPDATE users SET totp_secret = $2, totp_last_step = 0
+		WHERE id = $1 AND NOT totp_enabled
+	`, userID, secret)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+func (p *PostgresStore) EnableTOTP(ctx context.Context, userID uuid.UUID, step int64, recoveryHashes []string) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE users SET totp_enabled = TRUE, totp_last_step = $2
+		WHERE id = $1 AND totp_secret IS NOT NULL AND NOT totp_enabled
+	`, userID, step)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, h := range recoveryHashes {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)
+		`, userID, h); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) DisableTOTP(ctx context.Context, userID uuid.UUID) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0
+		WHERE id = $1
+	`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	res, err := p.DB.ExecContext(ctx, `
+		UPDATE users SET totp_last_step = $2
+		WHERE id = $1 AND totp_last_step < $2
+	`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+func (p *PostgresStore) UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash string) (bool, error) {
+	res, err := p.DB.ExecContext(ctx, `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hash)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+func (p *PostgresStore) CreateChallenge(ctx context.Context, hash string, userID uuid.UUID, expiresAt time.Time) error {
+	_, err := p.DB.ExecContext(ctx, `
+		INSERT INTO mfa_challenges (token_hash, user_id, expires_at) VALUES ($1, $2, $3)
+	`, hash, userID, expiresAt)
+	return err
+}
+
+func (p *PostgresStore) AttemptChallenge(ctx context.Context, hash string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := p.DB.QueryRowContext(ctx, `
+		UPDATE mfa_challenges SET attempts = attempts + 1
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND attempts < $2
+		RETURNING user_id
+	`, hash, maxChallengeAttempts).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, ErrChallengeInvalid
+	}
+	return userID, err
+}
+
+func (p *PostgresStore) ConsumeChallenge(ctx context.Context, hash string) error {
+	res, err := p.DB.ExecContext(ctx, `
+		UPDATE mfa_challenges SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL
+	`, hash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrChallengeInvalid
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxMessage is an event waiting to be relayed to Kafka.
+type OutboxMessage struct {
+	ID          int64
+	AggregateID uuid.UUID // used as the Kafka message key
+	EventType   string
+	Payload     json.RawMessage
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+}
+
+// OutboxStats summarizes the dispatch backlog.
+type OutboxStats struct {
+	Pending       int
+	OldestPending time.Time // zero when nothing is pending
+}
+
+type OutboxRepo interface {
+	// ClaimOutbox leases up to limit due messages for lease, so concurrent
+	// relays (other replicas) skip them until the lease expires.
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	MarkOutboxDispatched(ctx context.Context, id int64) error
+	// MarkOutboxFailed records the error and makes the message due again at retryAt.
+	MarkOutboxFailed(ctx context.Context, id int64, cause string, retryAt time.Time) error
+	OutboxStats(ctx context.Context) (OutboxStats, error)
+	// DeadLetterOutbox gives up on a message and moves it to the DLQ.
+	DeadLetterOutbox(ctx context.Context, id int64, reason string) error
+}
+
+// insertOutbox writes messages as part of tx.
+func insertOutbox(ctx context.Context, tx *sql.Tx, msgs []OutboxMessage) error {
+	for _, m := range msgs {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO outbox (aggregate_id, event_type, payload)
+			VALUES ($1, $2, $3)
+		`, m.AggregateID, m.EventType, []byte(m.Payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PostgresStore) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	rows, err := p.DB.QueryContext(ctx, `
+		UPDATE outbox o
+		SET available_at = NOW() + $2 * INTERVAL '1 millisecond',
+		    attempts     = o.attempts + 1
+		FROM (
+			SELECT id FROM outbox
+			WHERE status = 'pending' AND available_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		) due
+		WHERE o.id = due.id
+		RETURNING o.id, o.aggregate_id, o.event_type, o.payload, o.attempts, COALESCE(o.last_error, ''), o.created_at
+	`, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []OutboxMessage
+	for rows.Next() {
+		var (
+			m       OutboxMessage
+			payload []byte
+		)
+		if err := rows.Scan(&m.ID, &m.AggregateID, &m.EventType, &payload, &m.Attempts, &m.LastError, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.Payload = payload
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// UPDATE ... RETURNING does not keep the subquery order
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (p *PostgresStore) MarkOutboxDispatched(ctx context.Context, id int64) error {
+	_, err := p.DB.ExecContext(ctx, `
+		UPDATE outbox
+		SET status = 'dispatched', dispatched_at = NOW(), last_error = NULL
+		WHERE id = $1
+	`, id)
+	return err
+}
+
+func (p *PostgresStore) MarkOutboxFailed(ctx context.Context, id int64, cause string, retryAt time.Time) error {
+	_, err := p.DB.ExecContext(ctx, `
+		UPDATE outbox
+		SET last_error = $2, available_at = $3
+		WHERE id = $1 AND status = 'pending'
+	`, id, cause, retryAt)
+	return err
+}
+
+func (p *PostgresStore) OutboxStats(ctx context.Context) (OutboxStats, error) {
+	var (
+		s      OutboxStats
+		oldest sql.NullTime
+	)
+	err := p.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*), MIN(created_at)
+		FROM outbox
+		WHERE status = 'pending'
+	`).Scan(&s.Pending, &oldest)
+	if oldest.Valid {
+		s.OldestPending = oldest.Time
+	}
+	return s, err
+}
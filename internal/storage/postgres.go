@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"time"
+	"fmt"
+	"strings"
 
+	"github.com/AgentTarik/finance-api/internal/config"
+	"github.com/AgentTarik/finance-api/internal/money"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -14,29 +17,37 @@ import (
 var (
 	ErrUserAlreadyExists = errors.New("user already exists")
 	ErrUserNotFound      = errors.New("user not found")
+	ErrEmailTaken        = errors.New("email already in use")
+	ErrTxExists          = errors.New("transaction already exists")
+	ErrTxNotFound        = errors.New("transaction not found")
 )
 
 type UserAuth struct {
-	ID           uuid.UUID
-	Name         string
-	Email        string
-	PasswordHash string
+	ID            uuid.UUID
+	Name          string
+	Email         string
+	PasswordHash  string
+	Role          string
+	Scopes        []string // explicitly granted; empty means the role's defaults
+	TOTPEnabled   bool
+	EmailVerified bool
+	Deactivated   bool
 }
 
 type PostgresStore struct {
 	DB *sql.DB
 }
 
-func NewPostgres(dsn string) (*PostgresStore, error) {
-	db, err := sql.Open("pgx", dsn)
+func NewPostgres(cfg config.Database) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", cfg.DSN)
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxOpenConns(15)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(1 * time.Hour)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancel()
 	if err := db.PingContext(ctx); err != nil {
 		return nil, err
@@ -44,102 +55,322 @@ func NewPostgres(dsn string) (*PostgresStore, error) {
 	return &PostgresStore{DB: db}, nil
 }
 
-// CreateUserWithCredentials inserts a user with email + password hash.
-func (ps *PostgresStore) CreateUserWithCredentials(ctx context.Context, id uuid.UUID, name, email, passwordHash string) error {
-	_, err := ps.DB.ExecContext(ctx, `
-		INSERT INTO users (id, name, email, password_hash)
-		VALUES ($1, $2, $3, $4)
-	`, id, name, email, passwordHash)
-	return err
+// Users Repo
+
+func (p *PostgresStore) CreateUser(ctx context.Context, nu NewUser) (User, error) {
+	id, err := nu.idOrNew()
+	if err != nil {
+		return User{}, err
+	}
+	u, err := scanUser(p.DB.QueryRowContext(ctx, `
+		INSERT INTO users (id, name, email, password_hash, role)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+userColumns+`
+	`, id, nu.Name, nu.Email, nu.PasswordHash, nu.roleOrDefault()))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+		if pgErr.ConstraintName == "users_email_key" {
+			return User{}, ErrEmailTaken
+		}
+		return User{}, ErrUserAlreadyExists
+	}
+	return u, err
+}
+
+func (p *PostgresStore) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
+	u, err := scanUser(p.DB.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE id = $1 AND deactivated_at IS NULL
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	return u, err
 }
 
 // GetUserAuthByEmail returns user auth info by email.
-func (ps *PostgresStore) GetUserAuthByEmail(ctx context.Context, email string) (*UserAuth, error) {
-	row := ps.DB.QueryRowContext(ctx, `
-		SELECT id, name, email, password_hash
+func (p *PostgresStore) GetUserAuthByEmail(ctx context.Context, email string) (*UserAuth, error) {
+	return p.userAuth(ctx, "email", email)
+}
+
+// GetUserAuthByID returns user auth info by id.
+func (p *PostgresStore) GetUserAuthByID(ctx context.Context, id uuid.UUID) (*UserAuth, error) {
+	return p.userAuth(ctx, "id", id)
+}
+
+// userAuth reads the user whose column (a trusted identifier) equals v.
+func (p *PostgresStore) userAuth(ctx context.Context, column string, v any) (*UserAuth, error) {
+	row := p.DB.QueryRowContext(ctx, `
+		SELECT id, name, email, password_hash, role, scopes, totp_enabled, email_verified_at IS NOT NULL,
+		       deactivated_at IS NOT NULL
 		FROM users
-		WHERE email = $1
-	`, email)
-	var u UserAuth
-	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.PasswordHash); err != nil {
+		WHERE `+column+` = $1
+	`, v)
+	var (
+		u      UserAuth
+		scopes string
+	)
+	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.PasswordHash, &u.Role, &scopes, &u.TOTPEnabled, &u.EmailVerified, &u.Deactivated); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
 		return nil, err
 	}
+	u.Scopes = strings.Fields(scopes)
 	return &u, nil
 }
 
-// Users Repo
+const userColumns = `id, name, email, email_verified_at IS NOT NULL, created_at, updated_at, deactivated_at`
 
-func (p *PostgresStore) CreateUser(u User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func scanUser(r rowScanner) (User, error) {
+	var (
+		u           User
+		deactivated sql.NullTime
+	)
+	if err := r.Scan(&u.ID, &u.Name, &u.Email, &u.EmailVerified, &u.CreatedAt, &u.UpdatedAt, &deactivated); err != nil {
+		return User{}, err
+	}
+	if deactivated.Valid {
+		u.DeactivatedAt = &deactivated.Time
+	}
+	return u, nil
+}
 
-	_, err := p.DB.ExecContext(ctx,
-		`INSERT INTO users (id, name) VALUES ($1, $2)`, u.ID, u.Name)
+func (p *PostgresStore) UpdateUser(ctx context.Context, id uuid.UUID, upd UserUpdate) (User, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
-			return ErrUserAlreadyExists
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	var before string
+	err = tx.QueryRowContext(ctx, `
+		SELECT email FROM users WHERE id = $1 AND deactivated_at IS NULL FOR UPDATE
+	`, id).Scan(&before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	} else if err != nil {
+		return User{}, err
+	}
+
+	// SET expressions see the old row, so "email" below is the current one
+	u, err := scanUser(tx.QueryRowContext(ctx, `
+		UPDATE users SET
+			name  = COALESCE($2, name),
+			email = COALESCE($3, email),
+			email_verified_at = CASE WHEN $3::text IS NULL OR $3 = email THEN email_verified_at END,
+			updated_at = NOW()
+		WHERE id = $1 AND deactivated_at IS NULL
+		RETURNING `+userColumns+`
+	`, id, upd.Name, upd.Email))
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return User{}, ErrUserNotFound
+	case errors.As(err, &pgErr) && pgErr.Code == "23505": // unique_violation
+		return User{}, ErrEmailTaken
+	case err != nil:
+		return User{}, err
+	}
+	if u.Email != before {
+		// links mailed to the old address must not verify or reset the new one
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE action_tokens SET used_at = NOW()
+			WHERE user_id = $1 AND used_at IS NULL
+		`, id); err != nil {
+			return User{}, err
 		}
-		return err
 	}
-	return nil
+	return u, tx.Commit()
 }
 
-func (p *PostgresStore) GetUser(id uuid.UUID) (User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (p *PostgresStore) DeactivateUser(ctx context.Context, id uuid.UUID) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	var u User
-	err := p.DB.QueryRowContext(ctx,
-		`SELECT id, name FROM users WHERE id = $1`, id).
-		Scan(&u.ID, &u.Name)
+	res, err := tx.ExecContext(ctx, `
+		UPDATE users SET deactivated_at = NOW(), updated_at = NOW(),
+			tokens_revoked_before = date_trunc('second', NOW())
+		WHERE id = $1 AND deactivated_at IS NULL
+	`, id)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, ErrUserNotFound
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	for _, q := range []string{
+		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+		`UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+	} {
+		if _, err := tx.ExecContext(ctx, q, id); err != nil {
+			return err
 		}
-		return User{}, err
 	}
-	return u, nil
+	return tx.Commit()
 }
 
 // Transactions Repo
 
-func (p *PostgresStore) UpsertTx(t Transaction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (p *PostgresStore) InsertTx(ctx context.Context, t Transaction) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	_, err := p.DB.ExecContext(ctx, `
-		INSERT INTO transactions (transaction_id, user_id, amount, timestamp, status)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (transaction_id) DO UPDATE
-		SET user_id = EXCLUDED.user_id,
-		    amount  = EXCLUDED.amount,
-		    timestamp = EXCLUDED.timestamp,
-		    status  = EXCLUDED.status
-	`, t.TransactionID, t.UserID, t.Amount, t.Timestamp, t.Status)
-	return err
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO transactions (transaction_id, user_id, amount, currency, timestamp, status, category)
+		VALUES ($1, $2, $3::numeric, $4, $5, $6, $7)
+		ON CONFLICT (transaction_id) DO NOTHING
+	`, t.TransactionID, t.UserID, t.Amount.String(), t.Amount.Currency(), t.Timestamp, t.Status, t.Category)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTxExists
+	}
+	ch := StatusChange{TransactionID: t.TransactionID, To: t.Status, Reason: "created"}
+	if err := insertStatusHistory(ctx, tx, ch); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (p *PostgresStore) ListTx() ([]Transaction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// txColumns is the select list read by scanTx; "t" must alias transactions.
+const txColumns = `t.transaction_id, t.user_id, t.amount::text, t.currency, t.timestamp, t.category, t.status,
+	t.attempts, t.queued_at, t.created_at, t.updated_at, t.processed_at, COALESCE(t.last_error, '')`
 
-	rows, err := p.DB.QueryContext(ctx, `
-		SELECT transaction_id, user_id, amount, timestamp, status
-		FROM transactions
-		ORDER BY timestamp DESC`)
+func scanTx(r rowScanner) (Transaction, error) {
+	var (
+		t                Transaction
+		amount, currency string
+		processedAt      sql.NullTime
+	)
+	err := r.Scan(&t.TransactionID, &t.UserID, &amount, &currency, &t.Timestamp, &t.Category, &t.Status,
+		&t.Attempts, &t.QueuedAt, &t.CreatedAt, &t.UpdatedAt, &processedAt, &t.LastError)
 	if err != nil {
-		return nil, err
+		return Transaction{}, err
+	}
+	if processedAt.Valid {
+		t.ProcessedAt = &processedAt.Time
+	}
+	if t.Amount, err = money.Parse(amount, currency); err != nil {
+		return Transaction{}, err
+	}
+	return t, nil
+}
+
+func (p *PostgresStore) GetTx(ctx context.Context, id uuid.UUID) (Transaction, error) {
+	t, err := scanTx(p.DB.QueryRowContext(ctx, `
+		SELECT `+txColumns+`
+		FROM transactions t
+		WHERE t.transaction_id = $1
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Transaction{}, ErrTxNotFound
+	}
+	return t, err
+}
+
+func (p *PostgresStore) GetTxForUser(ctx context.Context, userID, id uuid.UUID) (Transaction, error) {
+	t, err := scanTx(p.DB.QueryRowContext(ctx, `
+		SELECT `+txColumns+`
+		FROM transactions t
+		WHERE t.transaction_id = $1 AND t.user_id = $2
+	`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Transaction{}, ErrTxNotFound
+	}
+	return t, err
+}
+
+func (p *PostgresStore) ListTxByUser(ctx context.Context, userID uuid.UUID, f TxFilter) (TxPage, error) {
+	return p.listTx(ctx, &userID, f)
+}
+
+func (p *PostgresStore) ListAllTx(ctx context.Context, f TxFilter) (TxPage, error) {
+	return p.listTx(ctx, nil, f)
+}
+
+// listTx returns one keyset page ordered by (timestamp, transaction_id); a
+// nil userID means every user.
+func (p *PostgresStore) listTx(ctx context.Context, userID *uuid.UUID, f TxFilter) (TxPage, error) {
+	f, cur, err := f.normalize()
+	if err != nil {
+		return TxPage{}, err
+	}
+
+	var (
+		where []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if userID != nil {
+		where = append(where, "t.user_id = "+arg(*userID))
+	}
+	if !f.From.IsZero() {
+		where = append(where, "t.timestamp >= "+arg(f.From))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "t.timestamp < "+arg(f.To))
+	}
+	if f.Status != "" {
+		where = append(where, "t.status = "+arg(f.Status))
+	}
+	if f.Currency != "" {
+		where = append(where, "t.currency = "+arg(f.Currency))
+	}
+	if f.Category != "" {
+		where = append(where, "t.category = "+arg(f.Category))
+	}
+	if f.MinAmount != nil {
+		where = append(where, "t.amount >= "+arg(f.MinAmount.String())+"::numeric")
+	}
+	if f.MaxAmount != nil {
+		where = append(where, "t.amount <= "+arg(f.MaxAmount.String())+"::numeric")
+	}
+	order, cmp := "DESC", "<"
+	if f.Sort == SortOldest {
+		order, cmp = "ASC", ">"
+	}
+	if cur != nil {
+		where = append(where, fmt.Sprintf("(t.timestamp, t.transaction_id) %s (%s, %s)",
+			cmp, arg(cur.Timestamp), arg(cur.ID)))
+	}
+
+	q := `SELECT ` + txColumns + ` FROM transactions t`
+	if len(where) > 0 {
+		q += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	q += fmt.Sprintf(` ORDER BY t.timestamp %s, t.transaction_id %s`, order, order)
+	if f.Limit > 0 {
+		q += ` LIMIT ` + arg(f.Limit+1) // one extra row tells whether a next page exists
+	}
+
+	rows, err := p.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return TxPage{}, err
 	}
 	defer rows.Close()
 
 	var out []Transaction
 	for rows.Next() {
-		var t Transaction
-		if err := rows.Scan(&t.TransactionID, &t.UserID, &t.Amount, &t.Timestamp, &t.Status); err != nil {
-			return nil, err
+		t, err := scanTx(rows)
+		if err != nil {
+			return TxPage{}, err
 		}
 		out = append(out, t)
 	}
-	return out, rows.Err()
+	if err := rows.Err(); err != nil {
+		return TxPage{}, err
+	}
+	return pageOf(out, f), nil
 }
@@ -0,0 +1,53 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/AgentTarik/finance-api/internal/config"
+	"github.com/AgentTarik/finance-api/internal/migrate"
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/AgentTarik/finance-api/internal/storage/storagetest"
+	"go.uber.org/zap"
+)
+
+// TEST_DB_DSN points the Postgres tests at a scratch database; they migrate
+// it up first. Without it they are skipped.
+func openTestPostgres(t *testing.T) *storage.PostgresStore {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+	cfg := config.Default().Database
+	cfg.DSN = dsn
+	ps, err := storage.NewPostgres(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ps.DB.Close() })
+
+	m, err := migrate.New(ps.DB, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
+
+func TestPostgresStoreUserRepo(t *testing.T) {
+	ps := openTestPostgres(t)
+	if err := storagetest.UserRepo(context.Background(), ps); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresStoreTxListing(t *testing.T) {
+	ps := openTestPostgres(t)
+	if err := storagetest.TxListing(context.Background(), ps); err != nil {
+		t.Fatal(err)
+	}
+}
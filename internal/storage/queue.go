@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QueueRepo is the durable job queue backed by "queued" rows of the
+// transactions table. A claimed row is leased to one worker; if the worker
+// dies the lease expires and another worker picks the row up again.
+type QueueRepo interface {
+	// ClaimQueued leases up to limit queued transactions (oldest first)
+	// and bumps their attempt count. Users with a transaction that is
+	// already leased or waiting for a retry are skipped entirely, so a
+	// user's transactions are never processed out of order. Claims are
+	// serialized per user across replicas (see ClaimQueued).
+	ClaimQueued(ctx context.Context, owner string, limit int, lease time.Duration) ([]Transaction, error)
+	// ReleaseTx drops the lease after a failed attempt, recording the cause
+	// and making the row claimable again at retryAt.
+	ReleaseTx(ctx context.Context, id uuid.UUID, retryAt time.Time, cause string) error
+	// UnclaimTx hands back a claimed row that was not attempted.
+	UnclaimTx(ctx context.Context, id uuid.UUID) error
+	// RecoverQueued clears expired leases left behind by crashed workers.
+	RecoverQueued(ctx context.Context) (int64, error)
+	// ResetQueued makes every queued row that is not leased claimable now,
+	// with a fresh attempt budget: pending retry backoffs are dropped.
+	ResetQueued(ctx context.Context) (int64, error)
+	CountQueued(ctx context.Context) (int, error)
+}
+
+func (p *PostgresStore) ClaimQueued(ctx context.Context, owner string, limit int, lease time.Duration) ([]Transaction, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// A lease another replica has not committed yet is invisible to the
+	// NOT EXISTS check below, so two replicas could claim rows of the same
+	// user at once. A per-user advisory lock, held until commit, rules that
+	// out: it is taken in its own statement, so the claim that follows sees
+	// every lease committed by whoever held it before. Users locked by
+	// another replica are skipped, like leased ones.
+	var users []string
+	lrows, err := tx.QueryContext(ctx, `
+		SELECT user_id FROM (
+			SELECT q.user_id, MIN(q.queued_at) AS first_queued FROM transactions q
+			WHERE q.status = 'queued'
+			  AND (q.lease_expires_at IS NULL OR q.lease_expires_at <= NOW())
+			  AND NOT EXISTS (
+			    SELECT 1 FROM transactions b
+			    WHERE b.user_id = q.user_id
+			      AND b.status = 'queued'
+			      AND b.lease_expires_at > NOW()
+			  )
+			GROUP BY q.user_id
+			ORDER BY first_queued
+			LIMIT $1
+		) due
+		WHERE pg_try_advisory_xact_lock(hashtext(user_id::text))
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	for lrows.Next() {
+		var id string
+		if err := lrows.Scan(&id); err != nil {
+			lrows.Close()
+			return nil, err
+		}
+		users = append(users, id)
+	}
+	lrows.Close()
+	if err := lrows.Err(); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE transactions t
+		SET lease_owner      = $2,
+		    lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond',
+		    attempts         = t.attempts + 1
+		FROM (
+			SELECT q.transaction_id FROM transactions q
+			WHERE q.status = 'queued'
+			  AND q.user_id = ANY($4::uuid[])
+			  AND (q.lease_expires_at IS NULL OR q.lease_expires_at <= NOW())
+			  AND NOT EXISTS (
+			    SELECT 1 FROM transactions b
+			    WHERE b.user_id = q.user_id
+			      AND b.status = 'queued'
+			      AND b.lease_expires_at > NOW()
+			  )
+			ORDER BY q.queued_at, q.transaction_id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		) due
+		WHERE t.transaction_id = due.transaction_id
+		RETURNING `+txColumns+`
+	`, limit, owner, lease.Milliseconds(), users)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Transaction
+	for rows.Next() {
+		t, err := scanTx(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	// UPDATE ... RETURNING does not keep the subquery order
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].QueuedAt.Equal(out[j].QueuedAt) {
+			return out[i].QueuedAt.Before(out[j].QueuedAt)
+		}
+		return out[i].TransactionID.String() < out[j].TransactionID.String()
+	})
+	return out, nil
+}
+
+func (p *PostgresStore) ReleaseTx(ctx context.Context, id uuid.UUID, retryAt time.Time, cause string) error {
+	_, err := p.DB.ExecContext(ctx, `
+		UPDATE transactions
+		SET lease_owner = NULL, lease_expires_at = $2, last_error = $3, updated_at = NOW()
+		WHERE transaction_id = $1 AND status = 'queued'
+	`, id, retryAt, cause)
+	return err
+}
+
+func (p *PostgresStore) UnclaimTx(ctx context.Context, id uuid.UUID) error {
+	_, err := p.DB.ExecContext(ctx, `
+		UPDATE transactions
+		SET lease_owner = NULL, lease_expires_at = NULL, attempts = GREATEST(attempts - 1, 0)
+		WHERE transaction_id = $1 AND status = 'queued'
+	`, id)
+	return err
+}
+
+func (p *PostgresStore) RecoverQueued(ctx context.Context) (int64, error) {
+	res, err := p.DB.ExecContext(ctx, `
+		UPDATE transactions
+		SET lease_owner = NULL, lease_expires_at = NULL
+		WHERE status = 'queued' AND lease_owner IS NOT NULL AND lease_expires_at <= NOW()
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *PostgresStore) ResetQueued(ctx context.Context) (int64, error) {
+	res, err := p.DB.ExecContext(ctx, `
+		UPDATE transactions
+		SET lease_owner = NULL, lease_expires_at = NULL, attempts = 0, updated_at = NOW()
+		WHERE status = 'queued' AND (lease_owner IS NULL OR lease_expires_at <= NOW())
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *PostgresStore) CountQueued(ctx context.Context) (int, error) {
+	var n int
+	err := p.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM transactions WHERE status = 'queued'`).Scan(&n)
+	return n, err
+}
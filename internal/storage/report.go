@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/money"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidBucket    = errors.New("invalid bucket")
+	ErrInvalidDimension = errors.New("invalid report dimension")
+)
+
+// ReportBucket is the width of a time-series bucket.
+type ReportBucket string
+
+const (
+	BucketDay   ReportBucket = "day"
+	BucketWeek  ReportBucket = "week" // ISO weeks, starting on Monday
+	BucketMonth ReportBucket = "month"
+)
+
+// ReportDimension is what a breakdown groups by.
+type ReportDimension string
+
+const (
+	ByStatus   ReportDimension = "status"
+	ByCategory ReportDimension = "category"
+	ByUser     ReportDimension = "user"
+)
+
+// ReportQuery selects the transactions a report aggregates; zero fields do
+// not filter. Amounts are always grouped by currency as well.
+type ReportQuery struct {
+	UserID   *uuid.UUID // nil means every user
+	From, To time.Time  // timestamp range, [From, To)
+	Status   string
+	Currency string
+	Location *time.Location // bucket boundaries; UTC when nil
+}
+
+// ReportRow is one aggregate. Group is set for breakdowns and Bucket (the
+// bucket start) for time series.
+type ReportRow struct {
+	Group    string
+	Bucket   time.Time
+	Currency string
+	Count    int64
+	Total    money.Money
+	Min      money.Money
+	Max      money.Money
+	Avg      string // decimal rounded to 4 places; not an exact ledger amount
+}
+
+type ReportRepo interface {
+	// ReportTotals aggregates the matching transactions per currency.
+	ReportTotals(ctx context.Context, q ReportQuery) ([]ReportRow, error)
+	// ReportBuckets aggregates per bucket and currency, oldest bucket first.
+	ReportBuckets(ctx context.Context, q ReportQuery, b ReportBucket) ([]ReportRow, error)
+	// ReportBreakdown aggregates per dimension value and currency. A status
+	// breakdown ignores q.Status.
+	ReportBreakdown(ctx context.Context, q ReportQuery, d ReportDimension) ([]ReportRow, error)
+}
+
+func (p *PostgresStore) ReportTotals(ctx context.Context, q ReportQuery) ([]ReportRow, error) {
+	return p.report(ctx, q, "''", "NULL::timestamptz")
+}
+
+func (p *PostgresStore) ReportBuckets(ctx context.Context, q ReportQuery, b ReportBucket) ([]ReportRow, error) {
+	switch b {
+	case BucketDay, BucketWeek, BucketMonth:
+	default:
+		return nil, ErrInvalidBucket
+	}
+	loc := "UTC"
+	if q.Location != nil {
+		loc = q.Location.String()
+	}
+	// truncate in the report's time zone, then convert back to an instant
+	return p.report(ctx, q, "''", "date_trunc($1, t.timestamp AT TIME ZONE $2) AT TIME ZONE $2", string(b), loc)
+}
+
+func (p *PostgresStore) ReportBreakdown(ctx context.Context, q ReportQuery, d ReportDimension) ([]ReportRow, error) {
+	var group string
+	switch d {
+	case ByStatus:
+		group, q.Status = "t.status", ""
+	case ByCategory:
+		group = "t.category"
+	case ByUser:
+		group = "t.user_id::text"
+	default:
+		return nil, ErrInvalidDimension
+	}
+	return p.report(ctx, q, group, "NULL::timestamptz")
+}
+
+// report runs one aggregate query grouped by currency plus the given group
+// and bucket expressions, which may refer to exprArgs as $1, $2, ...
+func (p *PostgresStore) report(ctx context.Context, q ReportQuery, group, bucket string, exprArgs ...any) ([]ReportRow, error) {
+	var where []string
+	args := exprArgs
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if q.UserID != nil {
+		where = append(where, "t.user_id = "+arg(*q.UserID))
+	}
+	if !q.From.IsZero() {
+		where = append(where, "t.timestamp >= "+arg(q.From))
+	}
+	if !q.To.IsZero() {
+		where = append(where, "t.timestamp < "+arg(q.To))
+	}
+	if q.Status != "" {
+		where = append(where, "t.status = "+arg(q.Status))
+	}
+	if q.Currency != "" {
+		where = append(where, "t.currency = "+arg(q.Currency))
+	}
+
+	sel := fmt.Sprintf(`
+		SELECT %s AS grp, %s AS bucket, t.currency, COUNT(*),
+		       SUM(t.amount)::text, MIN(t.amount)::text, MAX(t.amount)::text,
+		       ROUND(AVG(t.amount), 4)::text
+		FROM transactions t`, group, bucket)
+	if len(where) > 0 {
+		sel += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	sel += ` GROUP BY 1, 2, 3 ORDER BY 2, 1, 3`
+
+	rows, err := p.DB.QueryContext(ctx, sel, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ReportRow
+	for rows.Next() {
+		var (
+			r             ReportRow
+			b             sql.NullTime
+			total, lo, hi string
+		)
+		if err := rows.Scan(&r.Group, &b, &r.Currency, &r.Count, &total, &lo, &hi, &r.Avg); err != nil {
+			return nil, err
+		}
+		if b.Valid {
+			r.Bucket = b.Time
+		}
+		if r.Total, err = money.Parse(total, r.Currency); err != nil {
+			return nil, err
+		}
+		if r.Min, err = money.Parse(lo, r.Currency); err != nil {
+			return nil, err
+		}
+		if r.Max, err = money.Parse(hi, r.Currency); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
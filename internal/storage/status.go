@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrStatusConflict means the transaction was not in the expected state
+// (a concurrent change won, or the row does not exist).
+var ErrStatusConflict = errors.New("transaction status changed concurrently")
+
+// StatusChange is one transition of a transaction's status. From is empty
+// for the initial state; At is set by the store.
+type StatusChange struct {
+	TransactionID uuid.UUID
+	From          string
+	To            string
+	Reason        string
+	At            time.Time
+}
+
+type StatusRepo interface {
+	// ChangeStatus moves a transaction from ch.From to ch.To (compare-and-set)
+	// and records the transition, atomically.
+	ChangeStatus(ctx context.Context, ch StatusChange) error
+	// StatusHistory returns a transaction's transitions, oldest first.
+	StatusHistory(ctx context.Context, id uuid.UUID) ([]StatusChange, error)
+}
+
+func (p *PostgresStore) ChangeStatus(ctx context.Context, ch StatusChange) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := applyStatusChange(ctx, tx, ch); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyStatusChange performs the compare-and-set and writes the history row
+// inside tx. Leaving a state always drops any queue lease; re-entering the
+// queue starts with a fresh attempt budget.
+func applyStatusChange(ctx context.Context, tx *sql.Tx, ch StatusChange) error {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE transactions
+		SET status = $3,
+		    lease_owner = NULL,
+		    lease_expires_at = NULL,
+		    attempts = CASE WHEN $3 = 'queued' THEN 0 ELSE attempts END,
+		    updated_at = NOW(),
+		    processed_at = CASE WHEN $3 = 'processed' THEN NOW() ELSE processed_at END,
+		    last_error = CASE WHEN $3 = 'failed' THEN $4
+		                      WHEN $3 = 'processed' THEN NULL
+		                      ELSE last_error END
+		WHERE transaction_id = $1 AND status = $2
+	`, ch.TransactionID, ch.From, ch.To, ch.Reason)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrStatusConflict
+	}
+	return insertStatusHistory(ctx, tx, ch)
+}
+
+func insertStatusHistory(ctx context.Context, tx *sql.Tx, ch StatusChange) error {
+	var from any
+	if ch.From != "" {
+		from = ch.From
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO transaction_status_history (transaction_id, from_status, to_status, reason)
+		VALUES ($1, $2, $3, $4)
+	`, ch.TransactionID, from, ch.To, ch.Reason)
+	return err
+}
+
+func (p *PostgresStore) StatusHistory(ctx context.Context, id uuid.UUID) ([]StatusChange, error) {
+	rows, err := p.DB.QueryContext(ctx, `
+		SELECT COALESCE(from_status, ''), to_status, reason, changed_at
+		FROM transaction_status_history
+		WHERE transaction_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []StatusChange{}
+	for rows.Next() {
+		ch := StatusChange{TransactionID: id}
+		if err := rows.Scan(&ch.From, &ch.To, &ch.Reason, &ch.At); err != nil {
+			return nil, err
+		}
+		out = append(out, ch)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,205 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/money"
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/google/uuid"
+)
+
+// TxStore is what the listing suite needs: users to own the transactions
+// and the transactions themselves.
+type TxStore interface {
+	storage.UserRepo
+	storage.TxRepo
+}
+
+// TxListing checks the transaction listing contract: keyset pages in both
+// sort orders (ties on timestamp broken by id), cursor and sort validation,
+// every filter, and user scoping. It only reads rows of users and a
+// category it creates, so it can run against a database in use.
+func TxListing(ctx context.Context, repo TxStore) error {
+	c := &checker{}
+	newUser := func(name string) (storage.User, error) {
+		return repo.CreateUser(ctx, storage.NewUser{
+			Name: name, Email: "contract-" + uuid.NewString() + "@example.test", PasswordHash: "hash",
+		})
+	}
+	a, err := newUser("Ana")
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	b, err := newUser("Bia")
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+
+	// statuses other than queued keep a running worker off these rows
+	base := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	category := "contract-" + uuid.NewString()
+	specs := []struct {
+		user     storage.User
+		offset   time.Duration
+		amount   string
+		currency string
+		status   string
+		category string
+	}{
+		{a, 0, "10.00", "BRL", "processed", category},
+		{a, 0, "20.00", "BRL", "processed", category},
+		{a, 0, "30.00", "USD", "failed", category},
+		{a, time.Minute, "5.00", "BRL", "processed", category},
+		{a, time.Minute, "15.00", "BRL", "failed", category},
+		{a, 2 * time.Minute, "25.00", "USD", "processed", category},
+		{a, 3 * time.Minute, "40.00", "BRL", "cancelled", category + "-other"},
+		{b, time.Second, "1.00", "BRL", "processed", category},
+	}
+	txs := make([]storage.Transaction, len(specs))
+	for i, s := range specs {
+		amount, err := money.Parse(s.amount, s.currency)
+		if err != nil {
+			return fmt.Errorf("money.Parse(%q): %w", s.amount, err)
+		}
+		txs[i] = storage.Transaction{
+			TransactionID: uuid.New(),
+			UserID:        s.user.ID,
+			Amount:        amount,
+			Timestamp:     base.Add(s.offset),
+			Category:      s.category,
+			Status:        s.status,
+		}
+		if err := repo.InsertTx(ctx, txs[i]); err != nil {
+			return fmt.Errorf("InsertTx: %w", err)
+		}
+	}
+
+	// want lists the ids of txs at the given indexes in the given order.
+	want := func(sortBy storage.TxSort, idx ...int) []uuid.UUID {
+		rows := make([]storage.Transaction, len(idx))
+		for i, n := range idx {
+			rows[i] = txs[n]
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			x, y := rows[i], rows[j]
+			if sortBy == storage.SortOldest {
+				x, y = y, x
+			}
+			if !x.Timestamp.Equal(y.Timestamp) {
+				return x.Timestamp.After(y.Timestamp)
+			}
+			return bytes.Compare(x.TransactionID[:], y.TransactionID[:]) > 0
+		})
+		ids := make([]uuid.UUID, len(rows))
+		for i, t := range rows {
+			ids[i] = t.TransactionID
+		}
+		return ids
+	}
+	// walk follows NextCursor to the last page and returns every id seen.
+	walk := func(op string, list func(storage.TxFilter) (storage.TxPage, error), f storage.TxFilter) []uuid.UUID {
+		var ids []uuid.UUID
+		for pages := 0; ; pages++ {
+			if pages > len(txs) {
+				c.failf("%s: cursor does not reach the last page", op)
+				return ids
+			}
+			p, err := list(f)
+			if err != nil {
+				c.failf("%s: page %d: %v", op, pages+1, err)
+				return ids
+			}
+			if f.Limit > 0 && len(p.Items) > f.Limit {
+				c.failf("%s: page %d has %d rows, limit %d", op, pages+1, len(p.Items), f.Limit)
+			}
+			for _, t := range p.Items {
+				ids = append(ids, t.TransactionID)
+			}
+			if p.NextCursor == "" {
+				return ids
+			}
+			f.Cursor = p.NextCursor
+		}
+	}
+	same := func(op string, got, want []uuid.UUID) {
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			c.failf("%s: got ids %v, want %v", op, got, want)
+		}
+	}
+	byA := func(f storage.TxFilter) (storage.TxPage, error) { return repo.ListTxByUser(ctx, a.ID, f) }
+	byB := func(f storage.TxFilter) (storage.TxPage, error) { return repo.ListTxByUser(ctx, b.ID, f) }
+	all := func(f storage.TxFilter) (storage.TxPage, error) { return repo.ListAllTx(ctx, f) }
+	ofA := []int{0, 1, 2, 3, 4, 5, 6}
+
+	// page walks, with page sizes that do and do not split the ties
+	for _, s := range []storage.TxSort{"", storage.SortNewest, storage.SortOldest} {
+		order := s
+		if order == "" {
+			order = storage.SortNewest
+		}
+		for _, limit := range []int{0, 1, 2, 3, 7} {
+			op := fmt.Sprintf("ListTxByUser sort %q limit %d", s, limit)
+			same(op, walk(op, byA, storage.TxFilter{Sort: s, Limit: limit}), want(order, ofA...))
+		}
+	}
+	if p, err := byA(storage.TxFilter{Limit: len(ofA)}); err != nil || p.NextCursor != "" {
+		c.failf("ListTxByUser with limit == rows: got cursor %q, %v; want the last page", p.NextCursor, err)
+	}
+
+	// bad cursors and sorts
+	_, err = byA(storage.TxFilter{Cursor: "not-a-cursor", Limit: 2})
+	c.is("ListTxByUser with a garbage cursor", err, storage.ErrInvalidCursor)
+	if p, err := byA(storage.TxFilter{Sort: storage.SortNewest, Limit: 2}); err != nil {
+		c.failf("ListTxByUser: %v", err)
+	} else {
+		_, err = byA(storage.TxFilter{Sort: storage.SortOldest, Cursor: p.NextCursor, Limit: 2})
+		c.is("ListTxByUser with a cursor of the other sort order", err, storage.ErrInvalidCursor)
+	}
+	_, err = byA(storage.TxFilter{Sort: "amount"})
+	c.is("ListTxByUser with an unknown sort", err, storage.ErrInvalidSort)
+
+	// filters
+	brl := func(s string) *money.Money {
+		m, _ := money.Parse(s, "BRL")
+		return &m
+	}
+	filters := []struct {
+		name string
+		f    storage.TxFilter
+		idx  []int
+	}{
+		{"from/to", storage.TxFilter{From: base.Add(time.Minute), To: base.Add(3 * time.Minute)}, []int{3, 4, 5}},
+		{"status", storage.TxFilter{Status: "failed"}, []int{2, 4}},
+		{"currency", storage.TxFilter{Currency: "USD"}, []int{2, 5}},
+		{"category", storage.TxFilter{Category: category}, []int{0, 1, 2, 3, 4, 5}},
+		{"min_amount", storage.TxFilter{Currency: "BRL", MinAmount: brl("15")}, []int{1, 4, 6}},
+		{"max_amount", storage.TxFilter{Currency: "BRL", MaxAmount: brl("10")}, []int{0, 3}},
+		{"combined", storage.TxFilter{Currency: "BRL", Status: "processed", From: base}, []int{0, 1, 3}},
+	}
+	for _, tc := range filters {
+		for _, limit := range []int{0, 2} {
+			f := tc.f
+			f.Sort, f.Limit = storage.SortOldest, limit
+			op := fmt.Sprintf("ListTxByUser filter %s limit %d", tc.name, limit)
+			same(op, walk(op, byA, f), want(storage.SortOldest, tc.idx...))
+		}
+	}
+	_, err = byA(storage.TxFilter{MinAmount: brl("1")})
+	c.is("ListTxByUser with min_amount but no currency", err, money.ErrCurrencyMismatch)
+
+	// scoping
+	same("ListTxByUser of another user", walk("ListTxByUser", byB, storage.TxFilter{}), want(storage.SortNewest, 7))
+	same("ListAllTx", walk("ListAllTx", all, storage.TxFilter{Category: category, Limit: 3}),
+		want(storage.SortNewest, 0, 1, 2, 3, 4, 5, 7))
+	same("ListTxByUser of a user without transactions",
+		walk("ListTxByUser", func(f storage.TxFilter) (storage.TxPage, error) {
+			return repo.ListTxByUser(ctx, uuid.New(), f)
+		}, storage.TxFilter{}), nil)
+
+	return errors.Join(c.errs...)
+}
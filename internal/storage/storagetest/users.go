@@ -0,0 +1,125 @@
+// Package storagetest holds contract suites for the storage interfaces, so
+// every implementation (MemoryStore, PostgresStore) can be checked against
+// the same behaviour. Suites return an error listing every violation; call
+// them from a test or a one-off command, e.g.
+//
+//	if err := storagetest.UserRepo(ctx, storage.NewMemoryStore()); err != nil {
+//		t.Fatal(err)
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/google/uuid"
+)
+
+// checker collects contract violations.
+type checker struct {
+	errs []error
+}
+
+func (c *checker) failf(format string, args ...any) {
+	c.errs = append(c.errs, fmt.Errorf(format, args...))
+}
+
+// is records a violation unless err matches want.
+func (c *checker) is(op string, err, want error) {
+	if !errors.Is(err, want) {
+		c.failf("%s: got error %v, want %v", op, err, want)
+	}
+}
+
+// UserRepo checks the UserRepo contract. It only creates users with fresh
+// random ids and emails, so it can run against a database in use.
+func UserRepo(ctx context.Context, repo storage.UserRepo) error {
+	c := &checker{}
+	email := func() string { return "contract-" + uuid.NewString() + "@example.test" }
+
+	// server-generated id
+	a, err := repo.CreateUser(ctx, storage.NewUser{Name: "Ana", Email: email(), PasswordHash: "hash-a"})
+	if err != nil {
+		return fmt.Errorf("CreateUser without id: %w", err)
+	}
+	if a.ID.Version() != 7 {
+		c.failf("CreateUser without id: got id version %d, want 7", a.ID.Version())
+	}
+	if a.CreatedAt.IsZero() || a.UpdatedAt.IsZero() {
+		c.failf("CreateUser: timestamps not set")
+	}
+
+	// client-supplied id
+	bID := uuid.New()
+	b, err := repo.CreateUser(ctx, storage.NewUser{ID: bID, Name: "Bia", Email: email(), PasswordHash: "hash-b"})
+	if err != nil {
+		return fmt.Errorf("CreateUser with id: %w", err)
+	}
+	if b.ID != bID {
+		c.failf("CreateUser with id: got %s, want %s", b.ID, bID)
+	}
+
+	// conflicts
+	_, err = repo.CreateUser(ctx, storage.NewUser{ID: bID, Name: "Dup", Email: email(), PasswordHash: "x"})
+	c.is("CreateUser with a taken id", err, storage.ErrUserAlreadyExists)
+	_, err = repo.CreateUser(ctx, storage.NewUser{Name: "Dup", Email: a.Email, PasswordHash: "x"})
+	c.is("CreateUser with a taken email", err, storage.ErrEmailTaken)
+
+	// reads
+	if got, err := repo.GetUser(ctx, a.ID); err != nil {
+		c.failf("GetUser: %v", err)
+	} else if got.Name != "Ana" || got.Email != a.Email || got.EmailVerified {
+		c.failf("GetUser: got %+v, want the created user, unverified", got)
+	}
+	_, err = repo.GetUser(ctx, uuid.New())
+	c.is("GetUser of an unknown id", err, storage.ErrUserNotFound)
+
+	if ua, err := repo.GetUserAuthByEmail(ctx, a.Email); err != nil {
+		c.failf("GetUserAuthByEmail: %v", err)
+	} else if ua.ID != a.ID || ua.PasswordHash != "hash-a" || ua.Role != "user" || ua.Deactivated {
+		c.failf("GetUserAuthByEmail: got %+v, want user %s with its hash and role user", ua, a.ID)
+	}
+	_, err = repo.GetUserAuthByEmail(ctx, email())
+	c.is("GetUserAuthByEmail of an unknown email", err, storage.ErrUserNotFound)
+	if ua, err := repo.GetUserAuthByID(ctx, b.ID); err != nil {
+		c.failf("GetUserAuthByID: %v", err)
+	} else if ua.Email != b.Email || ua.PasswordHash != "hash-b" {
+		c.failf("GetUserAuthByID: got %+v, want user %s", ua, b.ID)
+	}
+	_, err = repo.GetUserAuthByID(ctx, uuid.New())
+	c.is("GetUserAuthByID of an unknown id", err, storage.ErrUserNotFound)
+
+	// updates
+	name, newEmail := "Ana Maria", email()
+	if got, err := repo.UpdateUser(ctx, a.ID, storage.UserUpdate{Name: &name}); err != nil {
+		c.failf("UpdateUser name: %v", err)
+	} else if got.Name != name || got.Email != a.Email {
+		c.failf("UpdateUser name: got %+v", got)
+	}
+	_, err = repo.UpdateUser(ctx, a.ID, storage.UserUpdate{Email: &b.Email})
+	c.is("UpdateUser to a taken email", err, storage.ErrEmailTaken)
+	if got, err := repo.UpdateUser(ctx, a.ID, storage.UserUpdate{Email: &newEmail}); err != nil {
+		c.failf("UpdateUser email: %v", err)
+	} else if got.Email != newEmail || got.Name != name || got.EmailVerified {
+		c.failf("UpdateUser email: got %+v, want the new email, unverified", got)
+	}
+	_, err = repo.UpdateUser(ctx, uuid.New(), storage.UserUpdate{Name: &name})
+	c.is("UpdateUser of an unknown id", err, storage.ErrUserNotFound)
+
+	// deactivation
+	if err := repo.DeactivateUser(ctx, b.ID); err != nil {
+		c.failf("DeactivateUser: %v", err)
+	}
+	_, err = repo.GetUser(ctx, b.ID)
+	c.is("GetUser of a deactivated user", err, storage.ErrUserNotFound)
+	if ua, err := repo.GetUserAuthByID(ctx, b.ID); err != nil || !ua.Deactivated {
+		c.failf("GetUserAuthByID of a deactivated user: got %+v, %v; want it marked deactivated", ua, err)
+	}
+	_, err = repo.UpdateUser(ctx, b.ID, storage.UserUpdate{Name: &name})
+	c.is("UpdateUser of a deactivated user", err, storage.ErrUserNotFound)
+	c.is("DeactivateUser twice", repo.DeactivateUser(ctx, b.ID), storage.ErrUserNotFound)
+
+	return errors.Join(c.errs...)
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// RefreshToken is a stored refresh token. Only the hash of the token is
+// kept; every rotation adds a token to the same family.
+type RefreshToken struct {
+	ID        uuid.UUID
+	FamilyID  uuid.UUID
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+type TokenRepo interface {
+	CreateRefreshToken(ctx context.Context, t RefreshToken) error
+	// RotateRefreshToken spends the token with the given hash and stores
+	// next in its family, returning the spent token. Presenting a token that
+	// was already spent revokes the whole family and returns
+	// ErrRefreshTokenReused.
+	RotateRefreshToken(ctx context.Context, hash string, next RefreshToken) (RefreshToken, error)
+	// RefreshTokenByHash looks up a token whether or not it is still usable.
+	RefreshTokenByHash(ctx context.Context, hash string) (RefreshToken, error)
+	RevokeRefreshFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error
+	// RevokeAccessToken blocks an access token (by jti) until it expires.
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeUserAccessTokens blocks every access token issued to the user
+	// so far (password change). Tokens issued within the same second survive,
+	// since "iat" has second precision.
+	RevokeUserAccessTokens(ctx context.Context, userID uuid.UUID) error
+	// IsAccessTokenRevoked reports whether the token jti, issued to userID at
+	// issuedAt, was revoked by jti or by user, or its user was deactivated.
+	IsAccessTokenRevoked(ctx context.Context, userID uuid.UUID, jti string, issuedAt time.Time) (bool, error)
+}
+
+const refreshTokenColumns = `id, family_id, user_id, token_hash, expires_at, created_at, used_at, revoked_at`
+
+func scanRefreshToken(r rowScanner) (RefreshToken, error) {
+	var (
+		t             RefreshToken
+		used, revoked sql.NullTime
+	)
+	if err := r.Scan(&t.ID, &t.FamilyID, &t.UserID, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &used, &revoked); err != nil {
+		return RefreshToken{}, err
+	}
+	if used.Valid {
+		t.UsedAt = &used.Time
+	}
+	if revoked.Valid {
+		t.RevokedAt = &revoked.Time
+	}
+	return t, nil
+}
+
+func (p *PostgresStore) CreateRefreshToken(ctx context.Context, t RefreshToken) error {
+	_, err := p.DB.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (id, family_id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, t.ID, t.FamilyID, t.UserID, t.TokenHash, t.ExpiresAt)
+	return err
+}
+
+func (p *PostgresStore) RotateRefreshToken(ctx context.Context, hash string, next RefreshToken) (RefreshToken, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	cur, err := scanRefreshToken(tx.QueryRowContext(ctx, `
+		SELECT `+refreshTokenColumns+`
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, hash))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return RefreshToken{}, ErrRefreshTokenInvalid
+	case err != nil:
+		return RefreshToken{}, err
+	case cur.RevokedAt != nil:
+		return RefreshToken{}, ErrRefreshTokenInvalid
+	case cur.UsedAt != nil:
+		// a spent token came back: it leaked, so end the whole session
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE refresh_tokens SET revoked_at = NOW()
+			WHERE family_id = $1 AND revoked_at IS NULL
+		`, cur.FamilyID); err != nil {
+			return RefreshToken{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return RefreshToken{}, err
+		}
+		return cur, ErrRefreshTokenReused
+	case !cur.ExpiresAt.After(time.Now()):
+		return RefreshToken{}, ErrRefreshTokenInvalid
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1
+	`, cur.ID); err != nil {
+		return RefreshToken{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (id, family_id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, next.ID, cur.FamilyID, cur.UserID, next.TokenHash, next.ExpiresAt); err != nil {
+		return RefreshToken{}, err
+	}
+	return cur, tx.Commit()
+}
+
+func (p *PostgresStore) RefreshTokenByHash(ctx context.Context, hash string) (RefreshToken, error) {
+	t, err := scanRefreshToken(p.DB.QueryRowContext(ctx, `
+		SELECT `+refreshTokenColumns+`
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, ErrRefreshTokenInvalid
+	}
+	return t, err
+}
+
+func (p *PostgresStore) RevokeRefreshFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := p.DB.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`, familyID)
+	return err
+}
+
+func (p *PostgresStore) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := p.DB.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	return err
+}
+
+func (p *PostgresStore) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	// entries for tokens that expired anyway are no longer needed
+	if _, err := p.DB.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	_, err := p.DB.ExecContext(ctx, `
+		INSERT INTO revoked_tokens (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`, jti, expiresAt)
+	return err
+}
+
+func (p *PostgresStore) RevokeUserAccessTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := p.DB.ExecContext(ctx, `
+		UPDATE users SET tokens_revoked_before = date_trunc('second', NOW()) WHERE id = $1
+	`, userID)
+	return err
+}
+
+func (p *PostgresStore) IsAccessTokenRevoked(ctx context.Context, userID uuid.UUID, jti string, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := p.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+		    OR EXISTS (SELECT 1 FROM users WHERE id = $2
+		               AND (deactivated_at IS NOT NULL OR tokens_revoked_before > $3))
+	`, jti, userID, issuedAt).Scan(&revoked)
+	return revoked, err
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/AgentTarik/finance-api/internal/money"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+// TxSort is the order of a transaction listing. Both orders break ties on
+// transaction_id so pages never overlap or skip rows.
+type TxSort string
+
+const (
+	SortNewest TxSort = "-timestamp" // default
+	SortOldest TxSort = "timestamp"
+)
+
+// TxFilter narrows transaction listings; zero fields do not filter.
+type TxFilter struct {
+	From, To  time.Time // timestamp range, [From, To)
+	Status    string
+	Currency  string
+	Category  string
+	MinAmount *money.Money // inclusive; must be in Currency
+	MaxAmount *money.Money // inclusive; must be in Currency
+	Sort      TxSort
+	Cursor    string // NextCursor of the previous page
+	Limit     int    // <= 0 means no limit
+}
+
+// TxPage is one page of a listing. NextCursor is empty on the last page.
+type TxPage struct {
+	Items      []Transaction
+	NextCursor string
+}
+
+// txCursor is the keyset position after the last row of a page. It is
+// handed out base64-encoded so clients treat it as opaque.
+type txCursor struct {
+	Timestamp time.Time `json:"ts"`
+	ID        uuid.UUID `json:"id"`
+	Sort      TxSort    `json:"s"`
+}
+
+func encodeCursor(t Transaction, s TxSort) string {
+	b, _ := json.Marshal(txCursor{Timestamp: t.Timestamp, ID: t.TransactionID, Sort: s})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns nil for an empty cursor. A cursor minted for another
+// sort order is rejected.
+func decodeCursor(s string, sort TxSort) (*txCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c txCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// normalize validates f and fills in defaults.
+func (f TxFilter) normalize() (TxFilter, *txCursor, error) {
+	switch f.Sort {
+	case "":
+		f.Sort = SortNewest
+	case SortNewest, SortOldest:
+	default:
+		return f, nil, ErrInvalidSort
+	}
+	for _, b := range []*money.Money{f.MinAmount, f.MaxAmount} {
+		if b != nil && b.Currency() != f.Currency {
+			return f, nil, money.ErrCurrencyMismatch
+		}
+	}
+	c, err := decodeCursor(f.Cursor, f.Sort)
+	return f, c, err
+}
+
+// match reports whether t passes every filter but the cursor.
+func (f TxFilter) match(t Transaction) bool {
+	switch {
+	case !f.From.IsZero() && t.Timestamp.Before(f.From),
+		!f.To.IsZero() && !t.Timestamp.Before(f.To),
+		f.Status != "" && t.Status != f.Status,
+		f.Currency != "" && t.Amount.Currency() != f.Currency,
+		f.Category != "" && t.Category != f.Category:
+		return false
+	}
+	if f.MinAmount != nil {
+		if c, err := t.Amount.Cmp(*f.MinAmount); err != nil || c < 0 {
+			return false
+		}
+	}
+	if f.MaxAmount != nil {
+		if c, err := t.Amount.Cmp(*f.MaxAmount); err != nil || c > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// txBefore orders transactions by (timestamp, transaction_id) ascending,
+// the same way Postgres compares the row values.
+func txBefore(a Transaction, ts time.Time, id uuid.UUID) bool {
+	if !a.Timestamp.Equal(ts) {
+		return a.Timestamp.Before(ts)
+	}
+	return bytes.Compare(a.TransactionID[:], id[:]) < 0
+}
+
+// precedes reports whether t comes after the cursor in its sort order.
+func (c *txCursor) precedes(t Transaction) bool {
+	if c.Sort == SortOldest {
+		return txBefore(Transaction{Timestamp: c.Timestamp, TransactionID: c.ID}, t.Timestamp, t.TransactionID)
+	}
+	return txBefore(t, c.Timestamp, c.ID)
+}
+
+// pageOf trims rows (fetched with one extra row) to f.Limit and sets the
+// next cursor when more rows remain.
+func pageOf(rows []Transaction, f TxFilter) TxPage {
+	if f.Limit <= 0 || len(rows) <= f.Limit {
+		return TxPage{Items: rows}
+	}
+	rows = rows[:f.Limit]
+	return TxPage{Items: rows, NextCursor: encodeCursor(rows[len(rows)-1], f.Sort)}
+}
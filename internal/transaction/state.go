@@ -0,0 +1,72 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/AgentTarik/finance-api/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownStatus     = errors.New("unknown transaction status")
+	ErrIllegalTransition = errors.New("illegal status transition")
+)
+
+// Status is the lifecycle state of a transaction.
+type Status string
+
+const (
+	Queued    Status = "queued"    // pending: waiting in the durable queue
+	Processed Status = "processed" // ledger entry posted
+	Failed    Status = "failed"    // gave up after repeated processing errors
+	Reversed  Status = "reversed"  // processed, then undone by a reversing entry
+	Cancelled Status = "cancelled" // withdrawn before processing
+)
+
+// transitions lists the legal moves out of each state.
+var transitions = map[Status][]Status{
+	Queued:    {Processed, Failed, Cancelled},
+	Processed: {Reversed},
+	Failed:    {Queued}, // manual retry
+	Reversed:  {},
+	Cancelled: {},
+}
+
+func ParseStatus(s string) (Status, error) {
+	st := Status(s)
+	if _, ok := transitions[st]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownStatus, s)
+	}
+	return st, nil
+}
+
+// CanTransition reports whether moving from s to to is legal.
+func (s Status) CanTransition(to Status) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Terminal reports whether no transition leaves s.
+func (s Status) Terminal() bool { return len(transitions[s]) == 0 }
+
+// Change validates a transition and returns it in the form the storage
+// layer persists (compare-and-set on from, plus a history row).
+func Change(id uuid.UUID, from, to Status, reason string) (storage.StatusChange, error) {
+	if _, ok := transitions[from]; !ok {
+		return storage.StatusChange{}, fmt.Errorf("%w: %q", ErrUnknownStatus, from)
+	}
+	if !from.CanTransition(to) {
+		return storage.StatusChange{}, fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+	return storage.StatusChange{
+		TransactionID: id,
+		From:          string(from),
+		To:            string(to),
+		Reason:        reason,
+	}, nil
+}
@@ -0,0 +1,58 @@
+package transaction
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTransitions(t *testing.T) {
+	all := []Status{Queued, Processed, Failed, Reversed, Cancelled}
+	// every legal move; any pair not listed must be refused
+	legal := map[[2]Status]bool{
+		{Queued, Processed}:   true,
+		{Queued, Failed}:      true,
+		{Queued, Cancelled}:   true,
+		{Processed, Reversed}: true,
+		{Failed, Queued}:      true,
+	}
+	if len(transitions) != len(all) {
+		t.Fatalf("transitions has %d states, the test knows %d: update both", len(transitions), len(all))
+	}
+
+	id := uuid.New()
+	for _, from := range all {
+		for _, to := range all {
+			want := legal[[2]Status{from, to}]
+			if got := from.CanTransition(to); got != want {
+				t.Errorf("%s -> %s: CanTransition = %v, want %v", from, to, got, want)
+			}
+			ch, err := Change(id, from, to, "test")
+			switch {
+			case want && err != nil:
+				t.Errorf("%s -> %s: Change: %v", from, to, err)
+			case want && (ch.TransactionID != id || ch.From != string(from) || ch.To != string(to) || ch.Reason != "test"):
+				t.Errorf("%s -> %s: Change = %+v", from, to, ch)
+			case !want && !errors.Is(err, ErrIllegalTransition):
+				t.Errorf("%s -> %s: Change: got error %v, want %v", from, to, err, ErrIllegalTransition)
+			}
+		}
+	}
+
+	for _, s := range all {
+		want := s == Reversed || s == Cancelled
+		if s.Terminal() != want {
+			t.Errorf("%s: Terminal = %v, want %v", s, s.Terminal(), want)
+		}
+	}
+	if _, err := Change(id, "pending", Processed, ""); !errors.Is(err, ErrUnknownStatus) {
+		t.Errorf("Change from an unknown status: got error %v, want %v", err, ErrUnknownStatus)
+	}
+	if _, err := Change(id, Queued, "done", ""); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("Change to an unknown status: got error %v, want %v", err, ErrIllegalTransition)
+	}
+	if _, err := ParseStatus("pending"); !errors.Is(err, ErrUnknownStatus) {
+		t.Errorf("ParseStatus(pending): got error %v, want %v", err, ErrUnknownStatus)
+	}
+}
@@ -2,149 +2,330 @@ package transaction
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
 	"time"
 
+	"github.com/AgentTarik/finance-api/internal/config"
+	"github.com/AgentTarik/finance-api/internal/ledger"
 	"github.com/AgentTarik/finance-api/internal/storage"
 	"github.com/AgentTarik/finance-api/telemetry"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
-type EventPublisher interface {
-	Publish(ctx context.Context, key string, v any) error
-}
+// ErrQueueFull is returned by Admit when the backlog is over capacity.
+var ErrQueueFull = errors.New("transaction queue full")
 
 // Validator
 type EventValidator interface {
 	Validate(v any) error
 }
 
+// Repo is the persistence the worker needs: the transaction store and its
+// durable queue, plus the ledger it posts into.
+type Repo interface {
+	storage.TxRepo
+	storage.QueueRepo
+	storage.StatusRepo
+	storage.LedgerRepo
+}
+
+// Worker processes transactions from the durable queue (status "queued" rows).
+// Nothing is held only in memory: a restart simply resumes from the table.
+//
+// Claimed transactions are sharded by user id over a pool of goroutines:
+// each shard handles its users sequentially (preserving per-user order)
+// while different shards run in parallel.
 type Worker struct {
-	log              *zap.Logger
-	repo             storage.TxRepo
-	ch               chan storage.Transaction
-	delay            time.Duration
-	pub              EventPublisher // can be nil
-	validator        EventValidator // can be nil
-	publishTimeout   time.Duration
-	maxRetries       int
-	retryBaseBackoff time.Duration
+	log          *zap.Logger
+	repo         Repo
+	owner        string        // lease owner id of this process
+	wake         chan struct{} // nudges the poll loop after an enqueue
+	capacity     int           // max queued rows before Admit pushes back
+	concurrency  int           // number of shards (goroutines)
+	delay        time.Duration
+	pollInterval time.Duration
+	batchSize    int
+	lease        time.Duration
+	maxAttempts  int
+	retryBackoff time.Duration
+	validator    EventValidator // can be nil
 }
 
-// keeps current signature
-func NewWorker(log *zap.Logger, repo storage.TxRepo, queueSize int, delay time.Duration) *Worker {
+func NewWorker(log *zap.Logger, repo Repo, cfg config.Worker) *Worker {
+	host, _ := os.Hostname()
 	return &Worker{
-		log:              log,
-		repo:             repo,
-		ch:               make(chan storage.Transaction, queueSize),
-		delay:            delay,
-		publishTimeout:   5 * time.Second,        // default
-		maxRetries:       3,                      // default
-		retryBaseBackoff: 200 * time.Millisecond, // default
+		log:          log,
+		repo:         repo,
+		owner:        fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8]),
+		wake:         make(chan struct{}, 1),
+		capacity:     cfg.Capacity,
+		concurrency:  cfg.Concurrency,
+		delay:        cfg.Delay,
+		pollInterval: cfg.PollInterval,
+		batchSize:    cfg.BatchSize,
+		lease:        cfg.Lease,
+		maxAttempts:  cfg.MaxAttempts,
+		retryBackoff: cfg.RetryBackoff,
 	}
 }
 
-// inject/adjust dependencies at runtime (follows current pattern)
-func (w *Worker) SetPublisher(pub EventPublisher)   { w.pub = pub }
-func (w *Worker) SetValidator(v EventValidator)     { w.validator = v }
-func (w *Worker) SetPublishTimeout(d time.Duration) { w.publishTimeout = d }
-func (w *Worker) SetRetry(max int, baseBackoff time.Duration) {
-	w.maxRetries = max
-	w.retryBaseBackoff = baseBackoff
+// inject dependencies at runtime (follows current pattern); tuning comes
+// from config.Worker
+func (w *Worker) SetValidator(v EventValidator) { w.validator = v }
+
+// Admit applies backpressure: it returns ErrQueueFull when the durable
+// backlog already holds capacity transactions.
+func (w *Worker) Admit(ctx context.Context) error {
+	n, err := w.repo.CountQueued(ctx)
+	if err != nil {
+		return err
+	}
+	telemetry.SetTransactionsQueued(n)
+	if n >= w.capacity {
+		return ErrQueueFull
+	}
+	return nil
 }
 
+// Enqueue wakes the worker for a transaction already persisted as queued.
 func (w *Worker) Enqueue(t storage.Transaction) {
 	select {
-	case w.ch <- t:
-		telemetry.SetWorkerQueueCurrent(len(w.ch))
-	default:
-		w.log.Warn("transaction queue full; dropping",
-			zap.String("tx_id", t.TransactionID.String()))
+	case w.wake <- struct{}{}:
+	default: // a wake-up is already pending
 	}
 }
 
+// shardBatch is the part of a claimed batch that belongs to one shard.
+type shardBatch struct {
+	txs  []storage.Transaction
+	done *sync.WaitGroup
+}
+
 func (w *Worker) Run(ctx context.Context) {
-	w.log.Info("transaction worker started")
+	w.log.Info("transaction worker started",
+		zap.String("owner", w.owner),
+		zap.Int("concurrency", w.concurrency))
+
+	shards := make([]chan shardBatch, w.concurrency)
+	for i := range shards {
+		shards[i] = make(chan shardBatch, 1)
+		go w.runShard(ctx, i, shards[i])
+		defer close(shards[i])
+	}
+
+	if n, err := w.repo.RecoverQueued(ctx); err != nil {
+		w.log.Error("queue recovery failed", zap.Error(err))
+	} else if n > 0 {
+		w.log.Info("recovered orphaned queued transactions", zap.Int64("count", n))
+	}
+
+	t := time.NewTicker(w.pollInterval)
+	defer t.Stop()
 	for {
+		// keep draining while full batches come back
+		for ctx.Err() == nil {
+			if w.processBatch(ctx, shards) < w.batchSize {
+				break
+			}
+		}
+		if n, err := w.repo.CountQueued(ctx); err == nil {
+			telemetry.SetTransactionsQueued(n)
+		}
+
 		select {
 		case <-ctx.Done():
 			w.log.Info("transaction worker stopped")
 			return
+		case <-w.wake:
+		case <-t.C:
+		}
+	}
+}
 
-		case t := <-w.ch:
-			telemetry.SetWorkerQueueCurrent(len(w.ch))
-			// 1) simulated "processing"
-			time.Sleep(w.delay)
+// processBatch claims one batch, fans it out to the shards and waits until
+// every shard is done with it. It returns how many transactions it claimed.
+func (w *Worker) processBatch(ctx context.Context, shards []chan shardBatch) int {
+	txs, err := w.repo.ClaimQueued(ctx, w.owner, w.batchSize, w.lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.log.Error("queue claim failed", zap.Error(err))
+		}
+		return 0
+	}
 
-			// 2) mark as processed and persist
-			t.Status = "processed"
-			if err := w.repo.UpsertTx(t); err != nil {
-				telemetry.IncTransactionsFailed("db")
-				w.log.Error("db upsert failed", zap.Error(err), zap.String("tx_id", t.TransactionID.String()))
-				continue
-			}
-			telemetry.IncTransactionsProcessed()
-			w.log.Info("transaction processed", zap.String("tx_id", t.TransactionID.String()))
-
-			// 3) build the event for Kafka
-			evt := map[string]any{
-				"type":      "transaction.created",
-				"version":   1,
-				"id":        t.TransactionID.String(),
-				"user_id":   t.UserID.String(),
-				"amount":    t.Amount,
-				"timestamp": t.Timestamp.UTC().Format(time.RFC3339),
-			}
+	parts := make([][]storage.Transaction, len(shards))
+	for _, t := range txs {
+		i := w.shardOf(t.UserID)
+		parts[i] = append(parts[i], t)
+	}
+	var wg sync.WaitGroup
+	for i, part := range parts {
+		telemetry.SetWorkerShardQueue(i, len(part))
+		if len(part) == 0 {
+			continue
+		}
+		wg.Add(1)
+		shards[i] <- shardBatch{txs: part, done: &wg}
+	}
+	wg.Wait()
+	return len(txs)
+}
 
-			// 4) validate the event (schema)
-			if w.validator != nil {
-				if err := w.validator.Validate(evt); err != nil {
-					telemetry.IncTransactionsFailed("schema")
-					w.log.Error("schema validation failed",
-						zap.Error(err),
-						zap.String("tx_id", t.TransactionID.String()))
-					// here you could send to a DLQ, error outbox, etc.
-					continue
-				}
-			}
+// shardOf maps a user to a shard, so all of a user's transactions are
+// handled by the same goroutine.
+func (w *Worker) shardOf(userID uuid.UUID) int {
+	h := fnv.New32a()
+	h.Write(userID[:])
+	return int(h.Sum32() % uint32(w.concurrency))
+}
 
-			// 5) publish to Kafka (with timeout + retries)
-			if w.pub != nil {
-				ctxPub, cancel := context.WithTimeout(ctx, w.publishTimeout)
-
-				var err error
-				for attempt := 0; attempt <= w.maxRetries; attempt++ {
-					w.log.Info("kafka publish attempt",
-						zap.Int("attempt", attempt+1),
-						zap.String("tx_id", t.TransactionID.String()))
-					err = w.pub.Publish(ctxPub, t.TransactionID.String(), evt)
-					if err == nil {
-						w.log.Info("kafka published",
-							zap.String("tx_id", t.TransactionID.String()))
-						break
-					}
-					// prepare backoff for next attempt
-					if attempt < w.maxRetries {
-						sleep := time.Duration(1<<attempt) * w.retryBaseBackoff
-						w.log.Warn("kafka publish retrying",
-							zap.Error(err),
-							zap.Duration("sleep", sleep),
-							zap.String("tx_id", t.TransactionID.String()))
-						time.Sleep(sleep)
-					}
-				}
-				cancel() // avoid leaking context
-
-				if err != nil {
-					telemetry.IncTransactionsFailed("kafka")
-					w.log.Error("kafka publish failed permanently",
-						zap.Error(err),
-						zap.String("tx_id", t.TransactionID.String()))
-					// optional: persist in outbox/DLQ for later reprocessing
-				}
-			} else {
-				w.log.Warn("kafka publisher is nil; skipping publish",
+// runShard processes the batches handed to one shard, in order, until Run
+// closes the channel.
+func (w *Worker) runShard(ctx context.Context, shard int, in <-chan shardBatch) {
+	for b := range in {
+		w.processShard(ctx, shard, b.txs)
+		telemetry.SetWorkerShardQueue(shard, 0)
+		b.done.Done()
+	}
+}
+
+func (w *Worker) processShard(ctx context.Context, shard int, txs []storage.Transaction) {
+	// users whose earlier transaction failed in this batch: their later ones
+	// must wait for the retry to keep per-user order
+	blocked := map[uuid.UUID]bool{}
+	for i, t := range txs {
+		if ctx.Err() != nil {
+			return // leases expire and another worker resumes
+		}
+		telemetry.SetWorkerShardQueue(shard, len(txs)-i)
+		if blocked[t.UserID] {
+			if err := w.repo.UnclaimTx(ctx, t.TransactionID); err != nil {
+				w.log.Error("unclaim failed", zap.Error(err), zap.String("tx_id", t.TransactionID.String()))
+			}
+			continue
+		}
+		if err := w.process(ctx, t); err != nil {
+			if ctx.Err() != nil {
+				return // interrupted by shutdown, not a failed attempt
+			}
+			if errors.Is(err, storage.ErrStatusConflict) {
+				// no longer queued (e.g. cancelled meanwhile): nothing to retry
+				w.log.Warn("transaction left the queue during processing",
 					zap.String("tx_id", t.TransactionID.String()))
+				continue
 			}
+			blocked[t.UserID] = true
+			w.retryOrFail(ctx, t, err)
+		}
+	}
+}
+
+// retryOrFail makes a failed transaction visible again after a backoff, or
+// marks it failed once it used up its attempts.
+func (w *Worker) retryOrFail(ctx context.Context, t storage.Transaction, cause error) {
+	if t.Attempts >= w.maxAttempts {
+		ch, err := Change(t.TransactionID, Queued, Failed, cause.Error())
+		if err == nil {
+			err = w.repo.ChangeStatus(ctx, ch)
+		}
+		if err != nil {
+			w.log.Error("mark failed failed", zap.Error(err), zap.String("tx_id", t.TransactionID.String()))
+			return
+		}
+		w.log.Error("transaction failed permanently",
+			zap.Error(cause),
+			zap.Int("attempts", t.Attempts),
+			zap.String("tx_id", t.TransactionID.String()))
+		return
+	}
+	retryAt := time.Now().Add(time.Duration(t.Attempts) * w.retryBackoff)
+	if err := w.repo.ReleaseTx(ctx, t.TransactionID, retryAt, cause.Error()); err != nil {
+		// the lease will expire on its own
+		w.log.Error("lease release failed", zap.Error(err), zap.String("tx_id", t.TransactionID.String()))
+	}
+}
+
+func (w *Worker) process(ctx context.Context, t storage.Transaction) error {
+	// 1) simulated "processing"; shutdown does not wait it out
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(w.delay):
+	}
+
+	// 2) build the balanced journal entry
+	entry, err := ledger.TransactionEntry(t.TransactionID, t.UserID, t.Amount, time.Now().UTC())
+	if err != nil {
+		telemetry.IncTransactionsFailed("ledger")
+		w.log.Error("ledger entry rejected", zap.Error(err), zap.String("tx_id", t.TransactionID.String()))
+		return err
+	}
+
+	// 3) build the event for Kafka
+	evt := map[string]any{
+		"type":      "transaction.created",
+		"version":   2,
+		"id":        t.TransactionID.String(),
+		"user_id":   t.UserID.String(),
+		"amount":    t.Amount.String(),
+		"currency":  t.Amount.Currency(),
+		"timestamp": t.Timestamp.UTC().Format(time.RFC3339),
+	}
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		telemetry.IncTransactionsFailed("schema")
+		w.log.Error("event encode failed", zap.Error(err), zap.String("tx_id", t.TransactionID.String()))
+		return err
+	}
+	msg := storage.OutboxMessage{
+		AggregateID: t.TransactionID,
+		EventType:   "transaction.created",
+		Payload:     payload,
+	}
+
+	// 4) validate the event (schema); rejected events go to the DLQ
+	// instead of the outbox, the transaction itself is still posted
+	events := []storage.OutboxMessage{msg}
+	var deadLetters []storage.DeadLetter
+	if w.validator != nil {
+		if verr := w.validator.Validate(evt); verr != nil {
+			telemetry.IncTransactionsFailed("schema")
+			w.log.Error("schema validation failed; sending event to DLQ",
+				zap.Error(verr),
+				zap.String("tx_id", t.TransactionID.String()))
+			deadLetters = []storage.DeadLetter{{
+				Source:      storage.DeadLetterSchema,
+				AggregateID: msg.AggregateID,
+				EventType:   msg.EventType,
+				Payload:     msg.Payload,
+				Reason:      verr.Error(),
+			}}
+			events = nil
 		}
 	}
+
+	// 5) mark as processed, post the entry and write the event to the
+	// outbox (or the DLQ) in one DB transaction; the outbox relay publishes
+	// it. A failed post leaves nothing behind, so retries add no duplicates
+	ch, err := Change(t.TransactionID, Queued, Processed, "ledger entry posted")
+	if err != nil {
+		return err
+	}
+	if err := w.repo.PostTx(ctx, ch, entry, events, deadLetters); err != nil {
+		telemetry.IncTransactionsFailed("db")
+		w.log.Error("ledger post failed", zap.Error(err), zap.String("tx_id", t.TransactionID.String()))
+		return err
+	}
+	if len(deadLetters) > 0 {
+		telemetry.IncDeadLetters(storage.DeadLetterSchema)
+	}
+	telemetry.IncTransactionsProcessed()
+	w.log.Info("transaction processed", zap.String("tx_id", t.TransactionID.String()))
+	return nil
 }
@@ -43,13 +43,68 @@ var (
 			Name: "transactions_failed_total",
 			Help: "Total number of transactions that failed, partitioned by reason.",
 		},
-		[]string{"reason"}, // reasons: validation | db | schema | kafka
+		[]string{"reason"}, // reasons: validation | backpressure | db | ledger | schema
 	)
 
-	workerQueueCurrent = prometheus.NewGauge(
+	transactionsQueuedCurrent = prometheus.NewGauge(
 		prometheus.GaugeOpts{
-			Name: "worker_queue_current",
-			Help: "Current number of items in the in-process worker queue (approximate).",
+			Name: "transactions_queued_current",
+			Help: "Current number of queued transactions in the durable worker queue (approximate).",
+		},
+	)
+
+	workerShardQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "worker_shard_queue_depth",
+			Help: "Transactions handed to a worker shard and not yet processed, partitioned by shard.",
+		},
+		[]string{"shard"},
+	)
+)
+
+// Outbox metrics
+var (
+	outboxDispatchedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "outbox_dispatched_total",
+			Help: "Total number of outbox events published to Kafka.",
+		},
+	)
+
+	outboxPublishFailedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "outbox_publish_failed_total",
+			Help: "Total number of failed outbox publish attempts (each is retried).",
+		},
+	)
+
+	outboxPendingCurrent = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "outbox_pending_current",
+			Help: "Current number of outbox events not yet dispatched.",
+		},
+	)
+
+	outboxOldestPendingSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "outbox_oldest_pending_age_seconds",
+			Help: "Age in seconds of the oldest undispatched outbox event (0 when empty).",
+		},
+	)
+
+	deadLettersTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dead_letters_total",
+			Help: "Total number of events sent to the dead-letter queue, partitioned by source.",
+		},
+		[]string{"source"}, // sources: schema | publish
+	)
+
+	outboxDispatchLagSeconds = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "outbox_dispatch_lag_seconds",
+			Help:    "Time between an event being written to the outbox and its dispatch to Kafka.",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300},
 		},
 	)
 )
@@ -88,6 +143,25 @@ var (
 	)
 )
 
+// Auth metrics
+var (
+	authLoginFailedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_login_failed_total",
+			Help: "Total number of rejected login attempts, partitioned by reason.",
+		},
+		[]string{"reason"}, // reasons: invalid_credentials | throttled | locked
+	)
+
+	authLoginLockoutsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_login_lockouts_total",
+			Help: "Total number of login lockouts, partitioned by what was locked.",
+		},
+		[]string{"kind"}, // kinds: email | ip
+	)
+)
+
 // InitMetrics called on startup
 func InitMetrics() {
 	prometheus.MustRegister(
@@ -95,11 +169,20 @@ func InitMetrics() {
 		httpRequestDurationSeconds,
 		transactionsProcessedTotal,
 		transactionsFailedTotal,
-		workerQueueCurrent,
+		transactionsQueuedCurrent,
+		workerShardQueueDepth,
+		outboxDispatchedTotal,
+		outboxPublishFailedTotal,
+		outboxPendingCurrent,
+		outboxOldestPendingSeconds,
+		outboxDispatchLagSeconds,
+		deadLettersTotal,
 		usersCreatedTotal,
 		usersCreateFailedTotal,
 		usersGetTotal,
 		usersTotalCurrent,
+		authLoginFailedTotal,
+		authLoginLockoutsTotal,
 	)
 }
 
@@ -128,4 +211,3 @@ func PrometheusMiddleware() gin.HandlerFunc {
 func MetricsHandler() gin.HandlerFunc {
 	return gin.WrapH(promhttp.Handler())
 }
-
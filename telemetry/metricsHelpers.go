@@ -1,19 +1,56 @@
 package telemetry
 
+import (
+	"strconv"
+	"time"
+)
+
 // IncTransactionsProcessed increments the business success counter.
 func IncTransactionsProcessed() {
 	transactionsProcessedTotal.Inc()
 }
 
 // Increments the business failure counter
-// Reasons: "validation", "db", "schema", "kafka".
+// Reasons: "validation", "backpressure", "db", "ledger", "schema".
 func IncTransactionsFailed(reason string) {
 	transactionsFailedTotal.WithLabelValues(reason).Inc()
 }
 
-// Sets the current queue size gauge.
-func SetWorkerQueueCurrent(n int) {
-	workerQueueCurrent.Set(float64(n))
+// Sets the durable queue backlog gauge.
+func SetTransactionsQueued(n int) {
+	transactionsQueuedCurrent.Set(float64(n))
+}
+
+// Sets the pending depth of one worker shard.
+func SetWorkerShardQueue(shard, n int) {
+	workerShardQueueDepth.WithLabelValues(strconv.Itoa(shard)).Set(float64(n))
+}
+
+// Increments the outbox dispatched counter.
+func IncOutboxDispatched() {
+	outboxDispatchedTotal.Inc()
+}
+
+// Increments the outbox failed publish counter.
+func IncOutboxFailed() {
+	outboxPublishFailedTotal.Inc()
+}
+
+// Records how long an event waited in the outbox before dispatch.
+func ObserveOutboxLag(d time.Duration) {
+	outboxDispatchLagSeconds.Observe(d.Seconds())
+}
+
+// Sets the outbox backlog gauges.
+func SetOutboxPending(n int, oldest time.Duration) {
+	outboxPendingCurrent.Set(float64(n))
+	outboxOldestPendingSeconds.Set(oldest.Seconds())
+}
+
+// Increments the dead-letter counter.
+// Sources: "schema", "publish".
+func IncDeadLetters(source string) {
+	deadLettersTotal.WithLabelValues(source).Inc()
 }
 
 // Increments both the created counter and the current total gauge.
@@ -43,3 +80,14 @@ func IncUsersGet(found bool) {
 func SetUsersTotal(n int) {
 	usersTotalCurrent.Set(float64(n))
 }
+
+// Increments the rejected login counter.
+// Reasons: "invalid_credentials", "throttled", "locked".
+func IncLoginFailed(reason string) {
+	authLoginFailedTotal.WithLabelValues(reason).Inc()
+}
+
+// Increments the lockout counter; kind is "email" or "ip".
+func IncLoginLockouts(kind string) {
+	authLoginLockoutsTotal.WithLabelValues(kind).Inc()
+}